@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// appIndexVersion must be bumped whenever AppEntry changes shape, or the way
+// desktop files are parsed into it changes, so stale indexes are rebuilt
+// rather than decoded with missing or outdated fields.
+const appIndexVersion = 2
+
+// appIndex is the serialized list of desktop entries cached between runs
+type appIndex struct {
+	Version int
+	Dirs    []string
+	Locale  string
+	Mtimes  map[string]int64 // every directory scanned and file read; 0 if it did not exist
+	Apps    []AppEntry
+}
+
+// appIndexPath returns the location of the desktop entry cache
+func appIndexPath() string {
+	return filepath.Join(xdgCacheHome(), "greg", "apps.gob")
+}
+
+// cachedDesktopFiles returns the same entries as readDesktopFiles, reusing
+// the cached index when none of the scanned directories or desktop files
+// have changed.
+func cachedDesktopFiles(dirs []string, locale string, log bool) ([]AppEntry, error) {
+	path := appIndexPath()
+	if idx, err := loadAppIndex(path); err == nil && idx.valid(dirs, locale) {
+		if log {
+			fmt.Printf("[DEBUG] Using cached desktop entry index %s\n", path)
+		}
+		return idx.Apps, nil
+	}
+
+	// Record mtimes before reading so concurrent changes invalidate the index
+	mtimes := entryMtimes(dirs)
+	apps, err := readDesktopFiles(dirs, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &appIndex{
+		Version: appIndexVersion,
+		Dirs:    dirs,
+		Locale:  locale,
+		Mtimes:  mtimes,
+		Apps:    apps,
+	}
+	if err := idx.save(path); err != nil && log {
+		fmt.Printf("[DEBUG] Failed to write desktop entry index: %v\n", err)
+	}
+	return apps, nil
+}
+
+// loadAppIndex decodes the index at path
+func loadAppIndex(path string) (*appIndex, error) {
+	idx := &appIndex{}
+	if err := loadGob(path, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// save writes the index atomically to path
+func (idx *appIndex) save(path string) error {
+	return saveGob(path, idx)
+}
+
+// loadGob decodes the gob-encoded file at path into v
+func loadGob(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gob.NewDecoder(f).Decode(v)
+}
+
+// saveGob atomically writes v gob-encoded to path
+func saveGob(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".greg-*.gob")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// valid reports whether the index was built for dirs and locale and no
+// scanned directory or desktop file has been modified since. Directory
+// mtimes catch added and removed files, file mtimes in-place edits.
+func (idx *appIndex) valid(dirs []string, locale string) bool {
+	if idx.Version != appIndexVersion || idx.Locale != locale || !slices.Equal(idx.Dirs, dirs) {
+		return false
+	}
+	for path, mtime := range idx.Mtimes {
+		if modTime(path) != mtime {
+			return false
+		}
+	}
+	return true
+}
+
+// entryMtimes returns the modification times of dirs, all their
+// subdirectories and the desktop files within. Missing dirs are recorded as
+// 0 so their creation is noticed.
+func entryMtimes(dirs []string) map[string]int64 {
+	mtimes := map[string]int64{}
+	for _, dir := range dirs {
+		mtimes[dir] = 0
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !(d.IsDir() || strings.HasSuffix(d.Name(), ".desktop")) {
+				return nil
+			}
+			mtimes[path] = modTime(path)
+			return nil
+		})
+	}
+	return mtimes
+}
+
+// modTime returns the modification time of path in nanoseconds, or 0 if it
+// cannot be read. Symlinks are followed, so edits to their target count.
+func modTime(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// mainCategories maps the freedesktop main categories to the submenu they are
+// listed under in the category view, in display order.
+var mainCategories = []struct {
+	label      string
+	categories []string
+}{
+	{"Accessories", []string{"Utility"}},
+	{"Development", []string{"Development"}},
+	{"Education", []string{"Education"}},
+	{"Games", []string{"Game"}},
+	{"Graphics", []string{"Graphics"}},
+	{"Internet", []string{"Network"}},
+	{"Multimedia", []string{"AudioVideo", "Audio", "Video"}},
+	{"Office", []string{"Office"}},
+	{"Science", []string{"Science"}},
+	{"Settings", []string{"Settings"}},
+	{"System", []string{"System"}},
+}
+
+// otherCategory holds apps without a recognized main category
+const otherCategory = "Other"
+
+// categoryMenu groups apps by their main categories into a two-level menu.
+// An app with several main categories is listed under each of them; empty
+// categories are omitted.
+func categoryMenu(apps []AppEntry) *MenuConfig {
+	groups := make([][]Menu, len(mainCategories))
+	var other []Menu
+
+	for i := range apps {
+		app := &apps[i]
+		item := Menu{Label: app.Name, app: app}
+
+		found := false
+		for j, mc := range mainCategories {
+			if slices.ContainsFunc(mc.categories, func(c string) bool {
+				return slices.Contains(app.Categories, c)
+			}) {
+				groups[j] = append(groups[j], item)
+				found = true
+			}
+		}
+		if !found {
+			other = append(other, item)
+		}
+	}
+
+	byLabel := func(a, b Menu) int {
+		return strings.Compare(strings.ToLower(a.Label), strings.ToLower(b.Label))
+	}
+
+	menu := &MenuConfig{Title: "greg"}
+	for i, mc := range mainCategories {
+		if len(groups[i]) == 0 {
+			continue
+		}
+		slices.SortStableFunc(groups[i], byLabel)
+		menu.Menu = append(menu.Menu, Menu{Label: mc.label, Items: groups[i]})
+	}
+	if len(other) > 0 {
+		slices.SortStableFunc(other, byLabel)
+		menu.Menu = append(menu.Menu, Menu{Label: otherCategory, Items: other})
+	}
+	return menu
+}
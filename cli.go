@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/chriso345/clifford"
 )
@@ -85,6 +86,74 @@ type CLIArgs struct {
 			Value             int
 			clifford.Clifford `long:"timeout" desc:"Auto-exit after N seconds of inactivity (0 disables)"`
 		}
+		HistoryKey struct {
+			Value             string
+			clifford.Clifford `long:"history-key" desc:"Keep a separate selection history under this name"`
+		}
+		Multi struct {
+			Value             bool
+			clifford.Clifford `long:"multi" desc:"Select several items with tab, shift+tab and ctrl+a"`
+		}
+		Read0 struct {
+			Value             bool
+			clifford.Clifford `long:"read0" desc:"Read NUL-separated items instead of lines"`
+		}
+		Print0 struct {
+			Value             bool
+			clifford.Clifford `long:"print0" desc:"Terminate printed selections with NUL instead of newline"`
+		}
+		Index struct {
+			Value             bool
+			clifford.Clifford `long:"index" desc:"Print the 0-based input position of the selection instead of its text"`
+		}
+	}
+
+	Run struct {
+		clifford.Subcommand `name:"run"`
+		clifford.Desc       `desc:"Run executables on $PATH; type arguments after the command"`
+
+		Prompt struct {
+			Value             string
+			clifford.Clifford `short:"p" long:"prompt" desc:"Prompt text"`
+		}
+		MaxItems struct {
+			Value             int
+			clifford.Clifford `short:"n" long:"max-items" desc:"Override max items (-1 for auto)"`
+		}
+		LogLevel struct {
+			Value             string
+			clifford.Clifford `long:"log-level" desc:"Set log level (debug|info|warn|error)"`
+		}
+		DryRun struct {
+			Value             bool
+			clifford.Clifford `long:"dry-run" desc:"Do not run commands; print them instead"`
+		}
+		NoCache struct {
+			Value             bool
+			clifford.Clifford `long:"no-cache" desc:"Rescan $PATH instead of using the cached index"`
+		}
+	}
+
+	Open struct {
+		clifford.Subcommand `name:"open"`
+		clifford.Desc       `desc:"Choose an app to open a file or URL with"`
+
+		Target struct {
+			Value             string
+			clifford.Clifford `required:"true" desc:"File path or URL to open"`
+		}
+		SetDefault struct {
+			Value             bool
+			clifford.Clifford `long:"set-default" desc:"Make the chosen app the default for this type"`
+		}
+		LogLevel struct {
+			Value             string
+			clifford.Clifford `long:"log-level" desc:"Set log level (debug|info|warn|error)"`
+		}
+		DryRun struct {
+			Value             bool
+			clifford.Clifford `long:"dry-run" desc:"Do not launch apps; print selection instead"`
+		}
 	}
 
 	Apps struct {
@@ -93,23 +162,49 @@ type CLIArgs struct {
 
 		DesktopDir struct {
 			Value             string
-			clifford.Clifford `long:"desktop-dir" desc:"Path to .desktop files"`
+			clifford.Clifford `long:"desktop-dir" desc:"Colon-separated list of directories to search for .desktop files"`
 		}
 		LogLevel struct {
 			Value             string
 			clifford.Clifford `long:"log-level" desc:"Set log level (debug|info|warn|error)"`
 		}
+		Actions struct {
+			Value             bool
+			clifford.Clifford `long:"actions" desc:"List desktop actions (e.g. New Private Window) as entries"`
+		}
+		Categories struct {
+			Value             bool
+			clifford.Clifford `long:"categories" desc:"Browse apps grouped by category"`
+		}
+		NoCache struct {
+			Value             bool
+			clifford.Clifford `long:"no-cache" desc:"Rescan .desktop files instead of using the cached index"`
+		}
+		ShowHidden struct {
+			Value             bool
+			clifford.Clifford `long:"show-hidden" desc:"Also list NoDisplay, Hidden and unavailable entries"`
+		}
 		DryRun struct {
 			Value             bool
 			clifford.Clifford `long:"dry-run" desc:"Do not launch apps; print selection instead"`
 		}
 	}
+
+	// Arguments after "--", e.g. files to open with the selected app
+	passthrough []string
 }
 
 // ParseArgs parses command-line flags using Clifford
 func ParseArgs() *CLIArgs {
 	args := &CLIArgs{}
 
+	// Clifford discards everything before "--", so split off the trailing
+	// arguments before handing the rest over
+	if i := slices.Index(os.Args, "--"); i > 0 {
+		args.passthrough = os.Args[i+1:]
+		os.Args = os.Args[:i]
+	}
+
 	if err := clifford.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, "Error parsing arguments:", err)
 		os.Exit(1)
@@ -20,6 +20,49 @@ type Config struct {
 
 	File string `toml:"file"`
 
+	// Locale for translated app names, overriding $LC_ALL/$LC_MESSAGES/$LANG
+	Locale string `toml:"locale"`
+
+	// Terminal emulator used for Terminal=true apps, e.g. "foot -e {cmd}"
+	Terminal string `toml:"terminal"`
+
+	// Command prefix for launched apps and menu exec items, e.g.
+	// "systemd-run --user --scope --unit=app-{id}-{rand} --"
+	LaunchWrapper string `toml:"launch_wrapper"`
+
+	// Append output of launched apps to $XDG_STATE_HOME/greg/logs/<id>.log
+	LaunchLog bool `toml:"launch_log"`
+
+	// Icon rendering: "auto", "kitty", "sixel" or "none"
+	Icons string `toml:"icons"`
+
+	// Icon theme to look icons up in before falling back to hicolor
+	IconTheme string `toml:"icon_theme"`
+
+	// Environment variables set for launched apps
+	Env map[string]string `toml:"env"`
+
+	Apps struct {
+		ShowActions  bool `toml:"show_actions"`
+		ShowComments bool `toml:"show_comments"`
+
+		// Command focusing the window of a running app, e.g.
+		// "swaymsg '[pid={pid}] focus'"
+		FocusCommand string `toml:"focus_command"`
+
+		// Per desktop file ID environment overrides
+		Env map[string]map[string]string `toml:"env"`
+
+		// Launchers without a .desktop file
+		Custom []CustomApp `toml:"custom"`
+
+		// New names keyed by desktop file ID or original name
+		Rename map[string]string `toml:"rename"`
+
+		// Globs or /regexps/ matched against app names and desktop file IDs
+		Hide []string `toml:"hide"`
+	} `toml:"apps"`
+
 	Colors struct {
 		Title    string `toml:"title"`
 		Prompt   string `toml:"prompt"`
@@ -77,6 +120,9 @@ func defaultConfig() *Config {
 	cfg.MaxItems = -1
 	cfg.DefaultMaxItems = 10
 
+	cfg.Icons = "auto"
+	cfg.IconTheme = "hicolor"
+
 	cfg.Colors.Title = "71"
 	cfg.Colors.Prompt = "79"
 	cfg.Colors.Item = "194"
@@ -139,6 +185,23 @@ func mergeStruct(dst, src reflect.Value) {
 		switch df.Kind() {
 		case reflect.Struct:
 			mergeStruct(df, sf)
+		case reflect.Map:
+			// Merge keys so chained configs extend rather than replace maps
+			if sf.Len() == 0 {
+				continue
+			}
+			if df.IsNil() {
+				df.Set(reflect.MakeMap(df.Type()))
+			}
+			iter := sf.MapRange()
+			for iter.Next() {
+				df.SetMapIndex(iter.Key(), iter.Value())
+			}
+		case reflect.Slice:
+			// Likewise append to lists
+			if sf.Len() > 0 {
+				df.Set(reflect.AppendSlice(df, sf))
+			}
 		default:
 			if !isZero(sf) {
 				df.Set(sf)
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// desktopGroup holds the raw key/value pairs of a single group in a desktop
+// entry file. Locale-suffixed keys such as "Name[de]" are stored verbatim.
+type desktopGroup map[string]string
+
+// desktopFile is a parsed freedesktop.org desktop entry file
+type desktopFile struct {
+	groups map[string]desktopGroup
+	order  []string
+}
+
+const desktopEntryGroup = "Desktop Entry"
+
+// parseDesktopFile reads and parses the desktop entry file at path
+func parseDesktopFile(path string) (*desktopFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	df, err := parseDesktop(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return df, nil
+}
+
+// parseDesktop parses desktop entry data according to the Desktop Entry
+// Specification: comments, groups, and key/value pairs with optional locale.
+func parseDesktop(r io.Reader) (*desktopFile, error) {
+	df, err := parseKeyFile(r, validDesktopKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(df.order) == 0 || df.order[0] != desktopEntryGroup {
+		return nil, fmt.Errorf("missing [%s] group", desktopEntryGroup)
+	}
+	return df, nil
+}
+
+// parseKeyFile parses the group/key=value format shared by desktop entries
+// and mimeapps.list. Keys rejected by validKey are skipped.
+func parseKeyFile(r io.Reader, validKey func(string) bool) (*desktopFile, error) {
+	df := &desktopFile{groups: map[string]desktopGroup{}}
+
+	var current desktopGroup
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Group header
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				// Skip the malformed group's keys rather than the whole file
+				current = nil
+				continue
+			}
+			name := line[1 : len(line)-1]
+			if _, ok := df.groups[name]; ok {
+				// Duplicate groups are invalid; ignore the later one
+				current = nil
+				continue
+			}
+			current = desktopGroup{}
+			df.groups[name] = current
+			df.order = append(df.order, name)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || current == nil {
+			// Invalid lines, and keys outside of (or in a duplicate)
+			// group, are ignored
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if !validKey(key) {
+			continue
+		}
+		if _, exists := current[key]; exists {
+			// First occurrence wins
+			continue
+		}
+		current[key] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return df, nil
+}
+
+// validDesktopKey reports whether key is a valid (optionally localized) key name
+func validDesktopKey(key string) bool {
+	name := key
+	if i := strings.IndexByte(key, '['); i >= 0 {
+		if !strings.HasSuffix(key, "]") || i == len(key)-2 {
+			return false
+		}
+		name = key[:i]
+	}
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// group returns the named group, or nil if it does not exist
+func (df *desktopFile) group(name string) desktopGroup {
+	return df.groups[name]
+}
+
+// String returns the unescaped value of key
+func (g desktopGroup) String(key string) string {
+	return unescapeDesktopValue(g[key])
+}
+
+// LocaleString returns the unescaped value of key best matching locale,
+// falling back to the unlocalized value.
+func (g desktopGroup) LocaleString(key, locale string) string {
+	for _, l := range localeVariants(locale) {
+		if v, ok := g[key+"["+l+"]"]; ok {
+			return unescapeDesktopValue(v)
+		}
+	}
+	return g.String(key)
+}
+
+// LocaleList returns the list value of key best matching locale
+func (g desktopGroup) LocaleList(key, locale string) []string {
+	for _, l := range localeVariants(locale) {
+		if v, ok := g[key+"["+l+"]"]; ok {
+			return splitDesktopList(v)
+		}
+	}
+	return g.List(key)
+}
+
+// localeVariants returns the locale keys to try for locale, most specific
+// first: lang_COUNTRY@MODIFIER, lang_COUNTRY, lang@MODIFIER, lang. The
+// encoding part is ignored.
+func localeVariants(locale string) []string {
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+
+	rest, modifier, _ := strings.Cut(locale, "@")
+	rest, _, _ = strings.Cut(rest, ".")
+	lang, country, _ := strings.Cut(rest, "_")
+	if lang == "" {
+		return nil
+	}
+
+	var variants []string
+	if country != "" && modifier != "" {
+		variants = append(variants, lang+"_"+country+"@"+modifier)
+	}
+	if country != "" {
+		variants = append(variants, lang+"_"+country)
+	}
+	if modifier != "" {
+		variants = append(variants, lang+"@"+modifier)
+	}
+	return append(variants, lang)
+}
+
+// messagesLocale returns the locale used for translated strings: the config
+// override, then $LC_ALL, $LC_MESSAGES and $LANG.
+func messagesLocale(cfg *Config) string {
+	if cfg.Locale != "" {
+		return cfg.Locale
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Bool returns the boolean value of key, false if unset or malformed
+func (g desktopGroup) Bool(key string) bool {
+	switch g[key] {
+	case "true", "1":
+		return true
+	}
+	return false
+}
+
+// List returns the semicolon-separated values of key
+func (g desktopGroup) List(key string) []string {
+	return splitDesktopList(g[key])
+}
+
+// unescapeDesktopValue expands the \s, \n, \t, \r and \\ escapes
+func unescapeDesktopValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i == len(s)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitDesktopList splits a list value on unescaped semicolons and unescapes
+// each element. Empty elements are dropped.
+func splitDesktopList(s string) []string {
+	var out []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			if s[i+1] == ';' {
+				cur.WriteByte(';')
+			} else {
+				cur.WriteByte(c)
+				cur.WriteByte(s[i+1])
+			}
+			i++
+			continue
+		}
+		if c == ';' {
+			if v := unescapeDesktopValue(cur.String()); v != "" {
+				out = append(out, v)
+			}
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if v := unescapeDesktopValue(cur.String()); v != "" {
+		out = append(out, v)
+	}
+	return out
+}
+
+// newAppEntry builds an AppEntry from a parsed desktop file, translating
+// names for locale. It returns false if the file does not describe a
+// launchable application.
+func newAppEntry(path string, df *desktopFile, locale string) (AppEntry, bool) {
+	g := df.group(desktopEntryGroup)
+	if g == nil || g.String("Type") != "Application" {
+		return AppEntry{}, false
+	}
+
+	app := AppEntry{
+		Name:        g.LocaleString("Name", locale),
+		Path:        path,
+		GenericName: g.LocaleString("GenericName", locale),
+		Comment:     g.LocaleString("Comment", locale),
+		Icon:        g.String("Icon"),
+		Exec:        g.String("Exec"),
+		TryExec:     g.String("TryExec"),
+		WorkDir:     g.String("Path"),
+		Terminal:    g.Bool("Terminal"),
+		NoDisplay:   g.Bool("NoDisplay"),
+		Hidden:      g.Bool("Hidden"),
+		OnlyShowIn:  g.List("OnlyShowIn"),
+		NotShowIn:   g.List("NotShowIn"),
+		Categories:  g.List("Categories"),
+		Keywords:    g.LocaleList("Keywords", locale),
+		MimeTypes:   g.List("MimeType"),
+	}
+	if app.Name == "" || app.Exec == "" {
+		return AppEntry{}, false
+	}
+	app.Binary = execBinary(app.Exec)
+
+	for _, id := range g.List("Actions") {
+		ag := df.group("Desktop Action " + id)
+		if ag == nil {
+			continue
+		}
+		action := AppAction{
+			ID:   id,
+			Name: ag.LocaleString("Name", locale),
+			Exec: ag.String("Exec"),
+			Icon: ag.String("Icon"),
+		}
+		if action.Name != "" && action.Exec != "" {
+			app.Actions = append(app.Actions, action)
+		}
+	}
+	return app, true
+}
+
+// execBinary returns the base name of the program run by an Exec line,
+// skipping a leading env invocation as execCommand does.
+func execBinary(execLine string) string {
+	cmd := execCommand(execLine)
+	if len(cmd) == 0 {
+		return ""
+	}
+	return filepath.Base(cmd[0])
+}
+
+// execCommand returns the program run by an Exec line followed by its fixed
+// arguments, i.e. those before the first field code, skipping a leading env
+// invocation with its options and variable assignments. It returns nil if
+// the program can't be determined.
+func execCommand(execLine string) []string {
+	tokens, err := tokenizeExec(execLine)
+	if err != nil || len(tokens) == 0 {
+		return nil
+	}
+
+	i := 0
+	if filepath.Base(tokens[0].text) == "env" {
+	envArgs:
+		for i = 1; i < len(tokens); i++ {
+			t := tokens[i].text
+			switch {
+			case t == "--":
+				i++
+				break envArgs
+			case t == "-u" || t == "--unset" || t == "-C" || t == "--chdir":
+				// The option's value is the next token
+				i++
+			case strings.HasPrefix(t, "-S") || strings.HasPrefix(t, "--split-string"):
+				// The program is inside a string env splits itself
+				return nil
+			case strings.HasPrefix(t, "-") || strings.Contains(t, "="):
+				// Other options, possibly with an attached value, and
+				// NAME=value assignments
+			default:
+				break envArgs
+			}
+		}
+	}
+	if i >= len(tokens) {
+		return nil
+	}
+
+	cmd := []string{tokens[i].text}
+	for _, arg := range tokens[i+1:] {
+		if strings.Contains(strings.ReplaceAll(arg.text, "%%", ""), "%") {
+			break
+		}
+		cmd = append(cmd, strings.ReplaceAll(arg.text, "%%", "%"))
+	}
+	return cmd
+}
+
+// searchText returns the secondary text apps are matched against besides
+// their name: generic name, keywords, categories, comment and binary.
+func (app AppEntry) searchText() string {
+	fields := []string{app.GenericName, app.Comment, app.Binary}
+	fields = append(fields, app.Keywords...)
+	fields = append(fields, app.Categories...)
+	return strings.Join(fields, " ")
+}
+
+// actionSeparator joins an application name and one of its action names
+const actionSeparator = " › "
+
+// withActions returns apps with an additional entry following each app for
+// every one of its desktop actions, e.g. "Firefox › New Private Window".
+func withActions(apps []AppEntry) []AppEntry {
+	var out []AppEntry
+	for _, app := range apps {
+		out = append(out, app)
+		for _, action := range app.Actions {
+			entry := app
+			entry.Name = app.Name + actionSeparator + action.Name
+			entry.Exec = action.Exec
+			entry.Action = action.ID
+			if action.Icon != "" {
+				entry.Icon = action.Icon
+			}
+			entry.Actions = nil
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// appLabels returns the label listing each of apps: its name, followed by
+// its desktop file ID when several apps share that name (e.g. a Flatpak and
+// a distribution package of the same program).
+func appLabels(apps []AppEntry) []string {
+	count := map[string]int{}
+	for _, app := range apps {
+		count[app.Name]++
+	}
+	labels := make([]string, len(apps))
+	for i, app := range apps {
+		labels[i] = app.Name
+		if count[app.Name] > 1 {
+			labels[i] += " (" + strings.TrimSuffix(app.ID, ".desktop") + ")"
+		}
+	}
+	return labels
+}
+
+// currentDesktops returns the desktop environments named by $XDG_CURRENT_DESKTOP
+func currentDesktops() []string {
+	var desktops []string
+	for d := range strings.SplitSeq(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if d != "" {
+			desktops = append(desktops, d)
+		}
+	}
+	return desktops
+}
+
+// appVisible reports whether app should be listed according to its NoDisplay,
+// Hidden, OnlyShowIn, NotShowIn and TryExec keys.
+func appVisible(app AppEntry, desktops []string) bool {
+	if app.NoDisplay || app.Hidden {
+		return false
+	}
+
+	if len(app.OnlyShowIn) > 0 && !slices.ContainsFunc(desktops, func(d string) bool {
+		return slices.Contains(app.OnlyShowIn, d)
+	}) {
+		return false
+	}
+	if slices.ContainsFunc(desktops, func(d string) bool {
+		return slices.Contains(app.NotShowIn, d)
+	}) {
+		return false
+	}
+
+	if app.TryExec != "" && !executableExists(app.TryExec) {
+		return false
+	}
+	return true
+}
+
+// visibleApps returns the apps that should be shown in the current desktop
+func visibleApps(apps []AppEntry) []AppEntry {
+	desktops := currentDesktops()
+
+	var out []AppEntry
+	for _, app := range apps {
+		if appVisible(app, desktops) {
+			out = append(out, app)
+		}
+	}
+	return out
+}
+
+// executableExists reports whether name is an executable file, either as an
+// absolute path or found on $PATH.
+func executableExists(name string) bool {
+	if filepath.IsAbs(name) {
+		info, err := os.Stat(name)
+		return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+	}
+	_, err := exec.LookPath(name)
+	return err == nil
+}
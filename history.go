@@ -0,0 +1,202 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+// historyLimit caps the number of items remembered per history file
+const historyLimit = 1000
+
+// historyEntry records how often and how recently an item was selected
+type historyEntry struct {
+	Count int   `toml:"count"`
+	Last  int64 `toml:"last"` // unix seconds
+}
+
+// History holds selection counts for one mode (or dmenu history key) and is
+// persisted under $XDG_STATE_HOME/greg/.
+type History struct {
+	path string
+	// scope is prefixed to items, keeping apart equal labels in different
+	// submenus
+	scope   string
+	Entries map[string]*historyEntry `toml:"entries"`
+}
+
+// historyPath returns the file used to store the history for key
+func historyPath(key string) string {
+	key = strings.NewReplacer("/", "_", string(os.PathSeparator), "_").Replace(key)
+	return filepath.Join(xdgStateHome(), "greg", "history-"+key+".toml")
+}
+
+// loadHistory reads the history for key. A missing file yields an empty history.
+func loadHistory(key string) (*History, error) {
+	h := &History{path: historyPath(key), Entries: map[string]*historyEntry{}}
+	if _, err := os.Stat(h.path); os.IsNotExist(err) {
+		return h, nil
+	}
+	if _, err := toml.DecodeFile(h.path, h); err != nil {
+		return h, err
+	}
+	if h.Entries == nil {
+		h.Entries = map[string]*historyEntry{}
+	}
+	return h, nil
+}
+
+// Record notes that item was selected now. Items that are not valid UTF-8
+// can't be stored as TOML keys and are not remembered.
+func (h *History) Record(item string) {
+	if !utf8.ValidString(item) {
+		return
+	}
+	e, ok := h.Entries[h.scope+item]
+	if !ok {
+		e = &historyEntry{}
+		h.Entries[h.scope+item] = e
+	}
+	e.Count++
+	e.Last = time.Now().Unix()
+}
+
+// Save writes the history to disk, dropping the lowest ranked items beyond historyLimit
+func (h *History) Save() error {
+	if len(h.Entries) > historyLimit {
+		now := time.Now()
+		keys := make([]string, 0, len(h.Entries))
+		for key := range h.Entries {
+			keys = append(keys, key)
+		}
+		slices.SortFunc(keys, func(a, b string) int {
+			return cmp.Compare(h.Entries[b].frecency(now), h.Entries[a].frecency(now))
+		})
+		for _, key := range keys[historyLimit:] {
+			delete(h.Entries, key)
+		}
+	}
+
+	// Write to a temporary file first so concurrent instances never leave a
+	// half-written history behind
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".greg-*.toml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := toml.NewEncoder(tmp).Encode(h); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), h.path)
+}
+
+// score returns the frecency of item within the current scope
+func (h *History) score(item string, now time.Time) float64 {
+	return h.Entries[h.scope+item].frecency(now)
+}
+
+// frecency returns the selection count of e weighted by how recently it was
+// last selected; a nil entry scores 0.
+func (e *historyEntry) frecency(now time.Time) float64 {
+	if e == nil {
+		return 0
+	}
+
+	age := now.Sub(time.Unix(e.Last, 0))
+	weight := 0.25
+	switch {
+	case age < 4*time.Hour:
+		weight = 4
+	case age < 24*time.Hour:
+		weight = 2
+	case age < 7*24*time.Hour:
+		weight = 1
+	case age < 30*24*time.Hour:
+		weight = 0.5
+	}
+	return float64(e.Count) * weight
+}
+
+// SetScope makes later lookups and records apply to items under scope; h
+// may be nil.
+func (h *History) SetScope(scope string) {
+	if h != nil {
+		h.scope = scope
+	}
+}
+
+// Sort orders items by descending frecency, keeping the original order for
+// items with equal scores.
+func (h *History) Sort(items []string) {
+	if h == nil || len(h.Entries) == 0 {
+		return
+	}
+	now := time.Now()
+	slices.SortStableFunc(items, func(a, b string) int {
+		return cmp.Compare(h.score(b, now), h.score(a, now))
+	})
+}
+
+// Merge adds the positions of items[from:] to order, the positions of
+// items[:from] ranked by descending frecency, keeping it ranked. Items
+// without history keep their input order at the end, so only the few
+// previously selected items need to be placed.
+func (h *History) Merge(order []int, items []string, from int) []int {
+	if h == nil || len(h.Entries) == 0 {
+		for pos := from; pos < len(items); pos++ {
+			order = append(order, pos)
+		}
+		return order
+	}
+	now := time.Now()
+	for pos := from; pos < len(items); pos++ {
+		s := h.score(items[pos], now)
+		if s == 0 {
+			order = append(order, pos)
+			continue
+		}
+		i := sort.Search(len(order), func(i int) bool { return h.score(items[order[i]], now) < s })
+		order = slices.Insert(order, i, pos)
+	}
+	return order
+}
+
+// openHistory loads the history for key, warning about (and starting over
+// from) a corrupt history file.
+func openHistory(key string) *History {
+	h, err := loadHistory(key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: ignoring unreadable history -", err)
+		h.Entries = map[string]*historyEntry{}
+	}
+	return h
+}
+
+// recordSelection records items in h and saves it; h may be nil
+func recordSelection(h *History, items ...string) {
+	if h == nil {
+		return
+	}
+	for _, item := range items {
+		h.Record(item)
+	}
+	if err := h.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to save history -", err)
+	}
+}
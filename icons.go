@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// iconSize is the nominal icon size, in pixels, looked up in icon themes
+const iconSize = 32
+
+// iconCols is the number of terminal cells an icon occupies
+const iconCols = 2
+
+// iconBaseDirs returns the directories searched for icon themes and
+// unthemed icons, in order of precedence.
+func iconBaseDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".icons"))
+	}
+	if home := xdgDataHome(); home != "" {
+		dirs = append(dirs, filepath.Join(home, "icons"))
+	}
+	for _, dir := range xdgDataDirs() {
+		dirs = append(dirs, filepath.Join(dir, "icons"))
+	}
+	return append(dirs, "/usr/share/pixmaps")
+}
+
+// iconDir is one subdirectory of an icon theme, as described in index.theme
+type iconDir struct {
+	path      string
+	size      int
+	scale     int
+	minSize   int
+	maxSize   int
+	threshold int
+	kind      string
+}
+
+// iconTheme is a parsed icon theme
+type iconTheme struct {
+	name     string
+	dirs     []iconDir
+	inherits []string
+}
+
+// iconLookup resolves icon names to PNG files following the Icon Theme
+// Specification, caching parsed themes.
+type iconLookup struct {
+	bases  []string
+	themes map[string]*iconTheme
+}
+
+func newIconLookup() *iconLookup {
+	return &iconLookup{bases: iconBaseDirs(), themes: map[string]*iconTheme{}}
+}
+
+// theme loads the named theme, or returns nil if it is not installed
+func (l *iconLookup) theme(name string) *iconTheme {
+	if t, ok := l.themes[name]; ok {
+		return t
+	}
+
+	var t *iconTheme
+	for _, base := range l.bases {
+		f, err := os.Open(filepath.Join(base, name, "index.theme"))
+		if err != nil {
+			continue
+		}
+		kf, err := parseKeyFile(f, func(string) bool { return true })
+		f.Close()
+		if err != nil {
+			continue
+		}
+
+		g := kf.group("Icon Theme")
+		if g == nil {
+			continue
+		}
+		t = &iconTheme{name: name, inherits: splitThemeList(g.String("Inherits"))}
+		subdirs := append(splitThemeList(g.String("Directories")), splitThemeList(g.String("ScaledDirectories"))...)
+		for _, sub := range subdirs {
+			dg := kf.group(sub)
+			if dg == nil {
+				continue
+			}
+			d := iconDir{
+				path:      sub,
+				size:      atoiDefault(dg.String("Size"), 0),
+				scale:     atoiDefault(dg.String("Scale"), 1),
+				threshold: atoiDefault(dg.String("Threshold"), 2),
+				kind:      dg.String("Type"),
+			}
+			if d.kind == "" {
+				d.kind = "Threshold"
+			}
+			d.minSize = atoiDefault(dg.String("MinSize"), d.size)
+			d.maxSize = atoiDefault(dg.String("MaxSize"), d.size)
+			t.dirs = append(t.dirs, d)
+		}
+		break
+	}
+
+	l.themes[name] = t
+	return t
+}
+
+// find returns the path of the PNG icon name at size, searching theme, its
+// parents, hicolor and finally unthemed icons. It returns "" if not found.
+func (l *iconLookup) find(name string, size int, theme string) string {
+	if name == "" {
+		return ""
+	}
+	if filepath.IsAbs(name) {
+		if strings.HasSuffix(strings.ToLower(name), ".png") {
+			if _, err := os.Stat(name); err == nil {
+				return name
+			}
+		}
+		return ""
+	}
+	name = strings.TrimSuffix(name, ".png")
+
+	visited := map[string]bool{}
+	if p := l.findInTheme(name, size, theme, visited); p != "" {
+		return p
+	}
+	if p := l.findInTheme(name, size, "hicolor", visited); p != "" {
+		return p
+	}
+
+	for _, base := range l.bases {
+		p := filepath.Join(base, name+".png")
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// findInTheme looks name up in theme and the themes it inherits from
+func (l *iconLookup) findInTheme(name string, size int, theme string, visited map[string]bool) string {
+	if visited[theme] {
+		return ""
+	}
+	visited[theme] = true
+
+	t := l.theme(theme)
+	if t == nil {
+		return ""
+	}
+
+	// Exact size match first, then the closest size
+	best, bestDist := "", -1
+	for _, d := range t.dirs {
+		for _, base := range l.bases {
+			p := filepath.Join(base, theme, d.path, name+".png")
+			if _, err := os.Stat(p); err != nil {
+				continue
+			}
+			if d.matchesSize(size) {
+				return p
+			}
+			if dist := d.sizeDistance(size); bestDist < 0 || dist < bestDist {
+				best, bestDist = p, dist
+			}
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	for _, parent := range t.inherits {
+		if p := l.findInTheme(name, size, parent, visited); p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// matchesSize implements DirectoryMatchesSize from the Icon Theme Specification
+func (d iconDir) matchesSize(size int) bool {
+	if d.scale != 1 {
+		return false
+	}
+	switch d.kind {
+	case "Fixed":
+		return d.size == size
+	case "Scalable":
+		return d.minSize <= size && size <= d.maxSize
+	default:
+		return d.size-d.threshold <= size && size <= d.size+d.threshold
+	}
+}
+
+// sizeDistance implements DirectorySizeDistance from the Icon Theme Specification
+func (d iconDir) sizeDistance(size int) int {
+	switch d.kind {
+	case "Scalable":
+		if size < d.minSize*d.scale {
+			return d.minSize*d.scale - size
+		}
+		if size > d.maxSize*d.scale {
+			return size - d.maxSize*d.scale
+		}
+		return 0
+	case "Fixed":
+		return abs(d.size*d.scale - size)
+	default:
+		if size < (d.size-d.threshold)*d.scale {
+			return d.minSize*d.scale - size
+		}
+		if size > (d.size+d.threshold)*d.scale {
+			return size - d.maxSize*d.scale
+		}
+		return 0
+	}
+}
+
+// iconRenderer renders icons next to items using the kitty graphics
+// protocol (with Unicode placeholders) or sixel.
+type iconRenderer struct {
+	protocol string // "kitty" or "sixel"
+	theme    string
+	cellW    int
+	cellH    int
+	lookup   *iconLookup
+	cache    map[string]string
+	nextID   uint32
+}
+
+// newIconRenderer returns a renderer for the graphics protocol selected by
+// cfg.Icons, or nil if icons are disabled or unsupported by the terminal.
+func newIconRenderer(cfg *Config) *iconRenderer {
+	protocol := cfg.Icons
+	if protocol == "" || protocol == "auto" {
+		protocol = detectGraphicsProtocol()
+	}
+	if protocol != "kitty" && protocol != "sixel" {
+		return nil
+	}
+
+	r := &iconRenderer{
+		protocol: protocol,
+		theme:    cfg.IconTheme,
+		cellW:    8,
+		cellH:    16,
+		lookup:   newIconLookup(),
+		cache:    map[string]string{},
+		nextID:   0x6e0000,
+	}
+	if r.theme == "" {
+		r.theme = "hicolor"
+	}
+	if ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ); err == nil &&
+		ws.Xpixel > 0 && ws.Ypixel > 0 && ws.Col > 0 && ws.Row > 0 {
+		r.cellW = int(ws.Xpixel / ws.Col)
+		r.cellH = int(ws.Ypixel / ws.Row)
+	}
+	return r
+}
+
+// detectGraphicsProtocol guesses the image protocol of the terminal from
+// its environment, returning "" if it supports none.
+func detectGraphicsProtocol() string {
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || program == "ghostty" || term == "xterm-ghostty":
+		return "kitty"
+	case strings.HasPrefix(term, "foot") || term == "mlterm" || program == "WezTerm" || program == "iTerm.app" || program == "contour":
+		return "sixel"
+	}
+	return ""
+}
+
+// render returns the escape sequences drawing icon in iconCols cells, or
+// blank cells when it cannot be found or decoded.
+func (r *iconRenderer) render(icon string) string {
+	if s, ok := r.cache[icon]; ok {
+		return s
+	}
+
+	blank := strings.Repeat(" ", iconCols+1)
+	s := blank
+	if path := r.lookup.find(icon, iconSize, r.theme); path != "" {
+		if img, err := loadPNG(path); err == nil {
+			switch r.protocol {
+			case "kitty":
+				s = r.kitty(img) + " "
+			case "sixel":
+				side := min(r.cellW*iconCols, r.cellH)
+				s = blank + "\x1b7" + fmt.Sprintf("\x1b[%dD", iconCols+1) + sixel(scaleImage(img, side, side)) + "\x1b8"
+			}
+		}
+	}
+
+	r.cache[icon] = s
+	return s
+}
+
+// kitty transmits img with a virtual placement and returns it together with
+// the Unicode placeholder cells that display it. The image is sent with
+// every render so it survives frames the TUI renderer skips.
+func (r *iconRenderer) kitty(img image.Image) string {
+	r.nextID++
+	id := r.nextID
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleImage(img, iconSize, iconSize)); err != nil {
+		return strings.Repeat(" ", iconCols)
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	var b strings.Builder
+	const chunk = 4096
+	for i := 0; i < len(data); i += chunk {
+		end := min(i+chunk, len(data))
+		more := 0
+		if end < len(data) {
+			more = 1
+		}
+		if i == 0 {
+			fmt.Fprintf(&b, "\x1b_Gf=100,a=T,U=1,q=2,i=%d,c=%d,r=1,m=%d;%s\x1b\\", id, iconCols, more, data[i:end])
+		} else {
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, data[i:end])
+		}
+	}
+
+	// Placeholder cells: the foreground color carries the image id and the
+	// diacritics the row and column
+	diacritics := []rune{0x0305, 0x030D, 0x030E, 0x0310}
+	fmt.Fprintf(&b, "\x1b[38;2;%d;%d;%dm", (id>>16)&0xff, (id>>8)&0xff, id&0xff)
+	for col := range iconCols {
+		b.WriteRune(0x10EEEE)
+		b.WriteRune(diacritics[0])
+		b.WriteRune(diacritics[col])
+	}
+	b.WriteString("\x1b[39m")
+	return b.String()
+}
+
+// loadPNG decodes the PNG file at path
+func loadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// scaleImage resizes img to w×h, averaging the source pixels covered by
+// each destination pixel.
+func scaleImage(img image.Image, w, h int) *image.NRGBA {
+	src := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	sw, sh := src.Dx(), src.Dy()
+
+	for y := range h {
+		y0 := src.Min.Y + y*sh/h
+		y1 := max(src.Min.Y+(y+1)*sh/h, y0+1)
+		for x := range w {
+			x0 := src.Min.X + x*sw/w
+			x1 := max(src.Min.X+(x+1)*sw/w, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+					// Weight colors by alpha so transparent pixels don't darken edges
+					r += uint64(c.R) * uint64(c.A)
+					g += uint64(c.G) * uint64(c.A)
+					b += uint64(c.B) * uint64(c.A)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			if a > 0 {
+				dst.SetNRGBA(x, y, color.NRGBA{uint8(r / a), uint8(g / a), uint8(b / a), uint8(a / n)})
+			}
+		}
+	}
+	return dst
+}
+
+// sixel encodes img as a sixel image using a 6×6×6 color cube. Pixels that
+// are mostly transparent are left unpainted.
+func sixel(img *image.NRGBA) string {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Map every pixel to a palette register, -1 for transparent
+	idx := make([]int, w*h)
+	used := map[int]bool{}
+	for y := range h {
+		for x := range w {
+			c := img.NRGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+			if c.A < 128 {
+				idx[y*w+x] = -1
+				continue
+			}
+			i := int(c.R)*5/255*36 + int(c.G)*5/255*6 + int(c.B)*5/255
+			idx[y*w+x] = i
+			used[i] = true
+		}
+	}
+
+	var b strings.Builder
+	// P2=1 keeps unpainted pixels transparent
+	fmt.Fprintf(&b, "\x1bP0;1;0q\"1;1;%d;%d", w, h)
+	for i := range 216 {
+		if used[i] {
+			r, g, bl := i/36, i/6%6, i%6
+			fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, r*100/5, g*100/5, bl*100/5)
+		}
+	}
+
+	for band := 0; band < h; band += 6 {
+		first := true
+		for color := range 216 {
+			if !used[color] {
+				continue
+			}
+			row := make([]byte, w)
+			any := false
+			for x := range w {
+				bits := 0
+				for dy := 0; dy < 6 && band+dy < h; dy++ {
+					if idx[(band+dy)*w+x] == color {
+						bits |= 1 << dy
+					}
+				}
+				row[x] = byte(63 + bits)
+				any = any || bits != 0
+			}
+			if !any {
+				continue
+			}
+			if !first {
+				b.WriteByte('$')
+			}
+			first = false
+			b.WriteString("#" + strconv.Itoa(color))
+			writeSixelRun(&b, row)
+		}
+		b.WriteByte('-')
+	}
+	b.WriteString("\x1b\\")
+	return b.String()
+}
+
+// writeSixelRun writes row using sixel run-length encoding
+func writeSixelRun(b *strings.Builder, row []byte) {
+	for i := 0; i < len(row); {
+		j := i
+		for j < len(row) && row[j] == row[i] {
+			j++
+		}
+		if n := j - i; n > 3 {
+			fmt.Fprintf(b, "!%d%c", n, row[i])
+		} else {
+			b.Write(bytes.Repeat([]byte{row[i]}, n))
+		}
+		i = j
+	}
+}
+
+// splitThemeList splits a comma-separated index.theme list
+func splitThemeList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// atoiDefault parses s as an integer, returning def if it is not one
+func atoiDefault(s string, def int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return def
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -1,39 +1,62 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 )
 
-func launchDesktopFile(path string) error {
-	data, err := os.ReadFile(path)
+// launchDesktopFile starts the application described by app, detached from
+// greg. Files are optional paths or URIs passed through the Exec field codes.
+func launchDesktopFile(cfg *Config, app AppEntry, files []string) error {
+	if app.Exec == "" {
+		return fmt.Errorf("no Exec line found in %s", app.Path)
+	}
+
+	argvs, err := expandExec(app, files)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid Exec line in %s: %w", app.Path, err)
 	}
 
-	var execLine string
-	for line := range strings.SplitSeq(string(data), "\n") {
-		if after, ok := strings.CutPrefix(line, "Exec="); ok {
-			execLine = strings.TrimSpace(after)
-			break
+	for _, argv := range argvs {
+		if app.Terminal {
+			if argv, err = terminalArgv(cfg, argv); err != nil {
+				return err
+			}
+		}
+		if argv, err = wrapperArgv(cfg, app.ID, app.Name, argv); err != nil {
+			return err
+		}
+		if os.Getenv("GREG_DRY_RUN") == "1" {
+			fmt.Fprintln(os.Stdout, "DRY-RUN-EXEC:", formatArgv(argv))
+			continue
+		}
+		if err := startDetached(argv, app.WorkDir, launchEnv(cfg, app.ID), launchLogPath(cfg, app.ID)); err != nil {
+			return err
 		}
 	}
-	if execLine == "" {
-		return fmt.Errorf("no Exec line found in %s", path)
-	}
+	return nil
+}
 
-	// Remove only placeholders %f %F %u %U %i %c %k
-	placeholders := []string{"%f", "%F", "%u", "%U", "%i", "%c", "%k"}
-	for _, ph := range placeholders {
-		execLine = strings.ReplaceAll(execLine, ph, "")
-	}
-	execLine = strings.TrimSpace(execLine)
+// launchGracePeriod is how long a detached process is watched for an
+// immediate failure before greg lets it go.
+const launchGracePeriod = 300 * time.Millisecond
 
-	// Use /bin/sh -c to handle quoted args
-	cmd := exec.Command("/bin/sh", "-c", execLine)
+// startDetached starts argv in a new session, in dir (greg's working
+// directory if empty) with env (greg's if nil). Output is appended to logPath,
+// or discarded if empty. An error is returned if the process exits with a
+// non-zero status within launchGracePeriod.
+func startDetached(argv []string, dir string, env []string, logPath string) error {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
 
 	// Detach from parent terminal
 	cmd.Stdout = nil
@@ -41,9 +64,375 @@ func launchDesktopFile(path string) error {
 	cmd.Stdin = nil
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 
-	if os.Getenv("GREG_DRY_RUN") == "1" {
-		fmt.Fprintln(os.Stdout, "DRY-RUN-EXEC:", execLine)
+	if logPath != "" {
+		if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		// The child keeps its own descriptor
+		defer logFile.Close()
+		fmt.Fprintf(logFile, "==> %s %s\n", time.Now().Format(time.RFC3339), formatArgv(argv))
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			return nil
+		}
+		msg := fmt.Sprintf("%s exited immediately: %v", argv[0], err)
+		if logPath != "" {
+			if tail := logTail(logPath, 5); tail != "" {
+				msg += "\n" + tail
+			}
+			msg += "\n(see " + logPath + ")"
+		}
+		return errors.New(msg)
+	case <-time.After(launchGracePeriod):
+		// Still running; leave it to itself
+		return cmd.Process.Release()
+	}
+}
+
+// launchLogPath returns the log file for output of the app with the given
+// desktop file ID (or other name), or "" when launch logging is disabled.
+func launchLogPath(cfg *Config, id string) string {
+	if !cfg.LaunchLog {
+		return ""
+	}
+	name := unitName(strings.TrimSuffix(id, ".desktop"))
+	if name == "" {
+		name = "greg"
+	}
+	return filepath.Join(xdgStateHome(), "greg", "logs", name+".log")
+}
+
+// logTail returns the last n lines of the file at path
+func logTail(path string, n int) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// launchEnv returns greg's environment with the global [env] overrides and
+// the [apps.env."<id>"] overrides for the desktop file id applied. Values may
+// reference other variables, e.g. "$HOME/bin:$PATH".
+func launchEnv(cfg *Config, id string) []string {
+	overrides := map[string]string{}
+	for k, v := range cfg.Env {
+		overrides[k] = v
+	}
+	for k, v := range cfg.Apps.Env[id] {
+		overrides[k] = v
+	}
+	if len(overrides) == 0 {
 		return nil
 	}
-	return cmd.Start()
+
+	env := os.Environ()
+	for k, v := range overrides {
+		env = append(env, k+"="+os.ExpandEnv(v))
+	}
+	return env
+}
+
+// terminalArgv wraps argv so it runs inside a terminal emulator. The
+// terminal comes from the config, then $TERMINAL, then x-terminal-emulator.
+// A "{cmd}" argument in the template is replaced by argv; without one, argv
+// is appended after "-e".
+func terminalArgv(cfg *Config, argv []string) ([]string, error) {
+	template := cfg.Terminal
+	if template == "" {
+		template = os.Getenv("TERMINAL")
+	}
+	if template == "" && executableExists("x-terminal-emulator") {
+		template = "x-terminal-emulator"
+	}
+	if template == "" {
+		return nil, fmt.Errorf("no terminal emulator configured; set \"terminal\" in config.toml or $TERMINAL")
+	}
+
+	out, substituted, err := expandTemplate(template, "{cmd}", argv, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid terminal template %q: %w", template, err)
+	}
+	if !substituted {
+		out = append(out, "-e")
+		out = append(out, argv...)
+	}
+	return out, nil
+}
+
+// wrapperArgv wraps argv in the configured launch_wrapper, if any. The
+// template may use {id} (desktop file ID without .desktop, safe for systemd
+// unit names), {name}, {rand} and {argv}; without {argv}, argv is appended.
+func wrapperArgv(cfg *Config, id, name string, argv []string) ([]string, error) {
+	if cfg.LaunchWrapper == "" {
+		return argv, nil
+	}
+
+	vars := map[string]string{
+		"{id}":   unitName(strings.TrimSuffix(id, ".desktop")),
+		"{name}": name,
+		"{rand}": fmt.Sprintf("%08x", rand.Uint32()),
+	}
+	out, substituted, err := expandTemplate(cfg.LaunchWrapper, "{argv}", argv, vars)
+	if err != nil {
+		return nil, fmt.Errorf("invalid launch_wrapper %q: %w", cfg.LaunchWrapper, err)
+	}
+	if !substituted {
+		out = append(out, argv...)
+	}
+	return out, nil
+}
+
+// expandTemplate tokenizes a command template, replacing vars and the argv
+// placeholder. A placeholder standing alone expands to the separate
+// arguments of argv; inside a larger argument it becomes a quoted command
+// line. It reports whether the placeholder was found.
+func expandTemplate(template, placeholder string, argv []string, vars map[string]string) ([]string, bool, error) {
+	tokens, err := tokenizeExec(template)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var out []string
+	substituted := false
+	for _, t := range tokens {
+		text := t.text
+		for k, v := range vars {
+			text = strings.ReplaceAll(text, k, v)
+		}
+		switch {
+		case text == placeholder && !t.quoted:
+			out = append(out, argv...)
+			substituted = true
+		case strings.Contains(text, placeholder):
+			out = append(out, strings.ReplaceAll(text, placeholder, formatArgv(argv)))
+			substituted = true
+		default:
+			out = append(out, text)
+		}
+	}
+	return out, substituted, nil
+}
+
+// unitName replaces characters not allowed in systemd unit names
+func unitName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(":_.-", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// execToken is a single argument of an Exec key before field code expansion
+type execToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeExec splits an (already string-unescaped) Exec value into
+// arguments following the quoting rules of the Desktop Entry Specification.
+func tokenizeExec(s string) ([]execToken, error) {
+	var tokens []execToken
+	var cur strings.Builder
+	inToken, quoted, inQuotes := false, false, false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuotes && c == '\\':
+			if i+1 < len(s) && strings.IndexByte("\"`$\\", s[i+1]) >= 0 {
+				i++
+				cur.WriteByte(s[i])
+			} else {
+				cur.WriteByte(c)
+			}
+		case inQuotes && c == '"':
+			inQuotes = false
+		case inQuotes:
+			cur.WriteByte(c)
+		case c == '"':
+			inToken, quoted, inQuotes = true, true, true
+		case c == '\\' && i+1 < len(s):
+			i++
+			inToken = true
+			cur.WriteByte(s[i])
+		case c == ' ' || c == '\t' || c == '\n':
+			if inToken {
+				tokens = append(tokens, execToken{text: cur.String(), quoted: quoted})
+				cur.Reset()
+				inToken, quoted = false, false
+			}
+		default:
+			inToken = true
+			cur.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inToken {
+		tokens = append(tokens, execToken{text: cur.String(), quoted: quoted})
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return tokens, nil
+}
+
+// expandExec returns the argument vectors needed to launch app with files.
+// Field codes are expanded per the spec; when the Exec line only accepts a
+// single file (%f or %u) and several are given, one argv per file is returned.
+func expandExec(app AppEntry, files []string) ([][]string, error) {
+	tokens, err := tokenizeExec(app.Exec)
+	if err != nil {
+		return nil, err
+	}
+
+	single := false
+	for _, t := range tokens {
+		if strings.Contains(t.text, "%f") || strings.Contains(t.text, "%u") {
+			single = true
+			break
+		}
+	}
+
+	if !single || len(files) <= 1 {
+		argv := expandFieldCodes(app, tokens, files)
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("empty command")
+		}
+		return [][]string{argv}, nil
+	}
+
+	var argvs [][]string
+	for _, f := range files {
+		argv := expandFieldCodes(app, tokens, []string{f})
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("empty command")
+		}
+		argvs = append(argvs, argv)
+	}
+	return argvs, nil
+}
+
+// expandFieldCodes builds a single argv from tokens, substituting field codes
+func expandFieldCodes(app AppEntry, tokens []execToken, files []string) []string {
+	var argv []string
+	for _, t := range tokens {
+		// Field codes that expand to zero or more whole arguments
+		if !t.quoted {
+			switch t.text {
+			case "%F":
+				argv = append(argv, filePaths(files)...)
+				continue
+			case "%U":
+				argv = append(argv, files...)
+				continue
+			case "%f":
+				if len(files) > 0 {
+					argv = append(argv, filePaths(files[:1])...)
+				}
+				continue
+			case "%u":
+				if len(files) > 0 {
+					argv = append(argv, files[0])
+				}
+				continue
+			case "%i":
+				if app.Icon != "" {
+					argv = append(argv, "--icon", app.Icon)
+				}
+				continue
+			}
+		}
+
+		if !strings.Contains(t.text, "%") {
+			argv = append(argv, t.text)
+			continue
+		}
+
+		// Field codes embedded inside a larger argument
+		var b strings.Builder
+		for i := 0; i < len(t.text); i++ {
+			c := t.text[i]
+			if c != '%' || i == len(t.text)-1 {
+				b.WriteByte(c)
+				continue
+			}
+			i++
+			switch t.text[i] {
+			case '%':
+				b.WriteByte('%')
+			case 'f', 'F':
+				if len(files) > 0 {
+					b.WriteString(filePaths(files[:1])[0])
+				}
+			case 'u', 'U':
+				if len(files) > 0 {
+					b.WriteString(files[0])
+				}
+			case 'i':
+				b.WriteString(app.Icon)
+			case 'c':
+				b.WriteString(app.Name)
+			case 'k':
+				b.WriteString(app.Path)
+			default:
+				// Deprecated (%d %D %n %N %v %m) and unknown codes are removed
+			}
+		}
+		if b.Len() == 0 && len(t.text) == 2 {
+			// A lone field code that expanded to nothing is dropped
+			// rather than passed as an empty argument
+			continue
+		}
+		argv = append(argv, b.String())
+	}
+	return argv
+}
+
+// filePaths converts file:// URIs to local paths; other values pass through
+func filePaths(files []string) []string {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		if u, err := url.Parse(f); err == nil && u.Scheme == "file" {
+			f = u.Path
+		}
+		paths = append(paths, f)
+	}
+	return paths
+}
+
+// formatArgv renders argv as a shell-quoted command line for display
+func formatArgv(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		if a != "" && !strings.ContainsAny(a, " \t\n'\"\\$`;&|<>()*?[]#~") {
+			quoted[i] = a
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
 }
@@ -1,18 +1,48 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"golang.org/x/term"
 )
 
+// AppEntry is a launchable application parsed from a .desktop file
 type AppEntry struct {
+	ID   string // desktop file ID, e.g. org.gnome.Terminal.desktop
 	Name string
-	Path string
+	Path string // path of the .desktop file
+
+	GenericName string
+	Comment     string
+	Icon        string
+	Exec        string
+	Binary      string // base name of the program in Exec
+	TryExec     string
+	WorkDir     string // the Path= key
+	Terminal    bool
+	NoDisplay   bool
+	Hidden      bool
+	OnlyShowIn  []string
+	NotShowIn   []string
+	Categories  []string
+	Keywords    []string
+	MimeTypes   []string
+	Actions     []AppAction
+
+	Action string // desktop action ID when this entry launches an action
+}
+
+// AppAction is an additional [Desktop Action] an application can perform
+type AppAction struct {
+	ID   string
+	Name string
+	Exec string
+	Icon string
 }
 
 func main() {
@@ -29,6 +59,10 @@ func main() {
 		modeName = "menu"
 	} else if args.Dmenu.Subcommand {
 		modeName = "dmenu"
+	} else if args.Run.Subcommand {
+		modeName = "run"
+	} else if args.Open.Subcommand {
+		modeName = "open"
 	} else if args.Apps.Subcommand {
 		modeName = "apps"
 	} else {
@@ -66,6 +100,19 @@ func main() {
 			lvl := args.Dmenu.LogLevel.Value
 			cfg.Log = !(lvl == "error" || lvl == "warn")
 		}
+	case "run":
+		if args.Run.MaxItems.Value != 0 {
+			cfg.MaxItems = args.Run.MaxItems.Value
+		}
+		if args.Run.LogLevel.Value != "" {
+			lvl := args.Run.LogLevel.Value
+			cfg.Log = !(lvl == "error" || lvl == "warn")
+		}
+	case "open":
+		if args.Open.LogLevel.Value != "" {
+			lvl := args.Open.LogLevel.Value
+			cfg.Log = !(lvl == "error" || lvl == "warn")
+		}
 	case "apps":
 		if args.Apps.LogLevel.Value != "" {
 			lvl := args.Apps.LogLevel.Value
@@ -75,6 +122,8 @@ func main() {
 
 	var items []string
 	var appEntries []AppEntry
+	var files []string
+	var mimeType, defaultID, defaultName string
 
 	switch modeName {
 	case "dmenu":
@@ -85,10 +134,52 @@ func main() {
 			os.Exit(1)
 		}
 
-		// Read piped items
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			items = append(items, scanner.Text())
+		// Piped items are streamed into the TUI once it is running
+
+	case "run":
+		items = pathExecutables(!args.Run.NoCache.Value, cfg.Log)
+
+	case "open":
+		files = fileArgs([]string{args.Open.Target.Value})
+		if !isURI(files[0]) {
+			if _, err := os.Stat(files[0]); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+		}
+		mimeType = fileMimeType(files[0])
+		if cfg.Log {
+			fmt.Printf("[DEBUG] %s has MIME type %q\n", files[0], mimeType)
+		}
+
+		all, err := cachedDesktopFiles(applicationDirs(), messagesLocale(cfg), cfg.Log)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading .desktop files:", err)
+			os.Exit(1)
+		}
+		all = applyAppOverrides(cfg, all)
+		// NoDisplay apps are often dedicated handlers, so only drop hidden
+		// and uninstalled ones
+		var installed []AppEntry
+		for _, app := range all {
+			if !app.Hidden && (app.TryExec == "" || executableExists(app.TryExec)) {
+				installed = append(installed, app)
+			}
+		}
+		if mimeType == "" {
+			appEntries = installed
+		} else {
+			appEntries, defaultID = mimeHandlers(installed, mimeType, loadMimeAssociations())
+		}
+		if len(appEntries) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no application can open %s (%s)\n", files[0], mimeType)
+			os.Exit(1)
+		}
+		items = appLabels(appEntries)
+		for i, app := range appEntries {
+			if app.ID == defaultID {
+				defaultName = items[i]
+			}
 		}
 
 	case "menu":
@@ -110,32 +201,62 @@ func main() {
 			}
 		}
 
-		runMenu(mnu, cfg, args)
+		if err := runMenu(mnu, cfg, args); err != nil {
+			os.Exit(1)
+		}
 		os.Exit(0)
 
 	case "apps":
-		// apps: load .desktop files, allow override via flag
-		dir := "/home/chris/.local/share/applications"
+		// apps: load .desktop files from the XDG data dirs, allow override via flag
+		dirs := applicationDirs()
 		if args.Apps.DesktopDir.Value != "" {
-			dir = args.Apps.DesktopDir.Value
+			dirs = filepath.SplitList(args.Apps.DesktopDir.Value)
+		}
+		if args.Apps.NoCache.Value {
+			appEntries, err = readDesktopFiles(dirs, messagesLocale(cfg))
+		} else {
+			appEntries, err = cachedDesktopFiles(dirs, messagesLocale(cfg), cfg.Log)
 		}
-		appEntries, err = readDesktopFiles(dir)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error reading .desktop files:", err)
 			os.Exit(1)
 		}
 
-		for _, app := range appEntries {
-			items = append(items, app.Name)
+		if cfg.Log {
+			fmt.Printf("[DEBUG] Read %d desktop entries\n", len(appEntries))
+		}
+		appEntries = applyAppOverrides(cfg, appEntries)
+		if !args.Apps.ShowHidden.Value {
+			appEntries = visibleApps(appEntries)
+		}
+		files = fileArgs(args.passthrough)
+		if len(files) > 0 {
+			appEntries = appsForFiles(appEntries, files)
+		}
+		if cfg.Apps.ShowActions || args.Apps.Actions.Value {
+			appEntries = withActions(appEntries)
+		}
 
-			// Print debug info
-			if cfg.Log {
+		if args.Apps.Categories.Value {
+			cfg.MaxItems = getMaxItems(cfg)
+			m := initialPersistentMenuModel(cfg, categoryMenu(appEntries), 0, args.Apps.DryRun.Value, "apps")
+			m.files = files
+			if err := runPersistentMenu(cfg, m); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		items = appLabels(appEntries)
+		if cfg.Log {
+			for _, app := range appEntries {
 				fmt.Printf("[DEBUG] Loaded app: %s (%s)\n", app.Name, app.Path)
 			}
 		}
 
 	default:
-		fmt.Fprintln(os.Stderr, "Error: unknown mode. Supported modes: dmenu, menu, apps")
+		fmt.Fprintln(os.Stderr, "Error: unknown mode. Supported modes: dmenu, menu, run, open, apps")
 		os.Exit(1)
 	}
 
@@ -156,13 +277,34 @@ func main() {
 		finalPrompt = args.Dmenu.Prompt.Value
 		finalOut = args.Dmenu.Out.Value
 		finalHeader = ""
+	case "open":
+		finalPrompt = "open with>"
+		finalOut = ""
+		finalHeader = ""
+	case "run":
+		finalPrompt = args.Run.Prompt.Value
+		finalOut = ""
+		finalHeader = ""
 	default: // apps
 		finalPrompt = ""
 		finalOut = ""
 		finalHeader = ""
 	}
 
+	// Rank previously selected items first
+	historyKey := modeName
+	if modeName == "dmenu" && args.Dmenu.HistoryKey.Value != "" {
+		historyKey = "dmenu-" + args.Dmenu.HistoryKey.Value
+	}
+	history := openHistory(historyKey)
+	history.Sort(items)
+	if i := slices.Index(items, defaultName); i > 0 {
+		// Keep the default handler on top in open mode
+		items = slices.Insert(slices.Delete(items, i, i+1), 0, defaultName)
+	}
+
 	mode := initialModelWithItems(cfg, modeName, finalPrompt, finalOut, finalHeader, items)
+	mode.history = history
 	// set timeout and dry-run from CLI flags per subcommand
 	switch modeName {
 	case "menu":
@@ -171,51 +313,109 @@ func main() {
 	case "dmenu":
 		mode.timeout = args.Dmenu.Timeout.Value
 		mode.dryRun = args.Dmenu.DryRun.Value
+		mode.multi = args.Dmenu.Multi.Value
+		mode.print0 = args.Dmenu.Print0.Value
+		mode.index = args.Dmenu.Index.Value
+		mode.stdin = os.Stdin
+		mode.read0 = args.Dmenu.Read0.Value
+		mode.loading = true
+	case "run":
+		mode.dryRun = args.Run.DryRun.Value
+	case "open":
+		mode.dryRun = args.Open.DryRun.Value
+		mode.setApps(appEntries, cfg.Apps.ShowComments)
+		mode.files = files
+		if defaultName != "" {
+			mode.setComment(defaultName, "(default)")
+		}
 	case "apps":
 		// apps has no timeout flag; keep default 0
 		mode.dryRun = args.Apps.DryRun.Value
+		mode.setApps(appEntries, cfg.Apps.ShowComments)
+		mode.files = files
+		mode.running = runningApps(mode.appsByLabel)
 	}
-	if _, err := RunTUIWithItems(cfg, mode, items, appEntries); err != nil {
+	selected, err := RunTUIWithItems(cfg, mode, items)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
-}
 
-// readDesktopFiles returns the "Name=" entries from all .desktop files in the folder
-func readDesktopFiles(dir string) ([]AppEntry, error) {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
+	if modeName == "open" && args.Open.SetDefault.Value && selected != "" && mimeType != "" && !mode.dryRun {
+		if app, ok := mode.appsByLabel[selected]; ok {
+			if err := setDefaultApp(mimeType, app.ID); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+		}
 	}
+}
 
+// readDesktopFiles returns the applications described by the .desktop files
+// found recursively under dirs, with names translated for locale. Dirs are
+// given in order of precedence: when several files share a desktop file ID,
+// only the first one found is used.
+func readDesktopFiles(dirs []string, locale string) ([]AppEntry, error) {
 	var apps []AppEntry
-	for _, f := range files {
-		if f.IsDir() || !strings.HasSuffix(f.Name(), ".desktop") {
-			continue
-		}
+	seen := map[string]bool{}
+	found := false
 
-		path := filepath.Join(dir, f.Name())
-		data, err := os.ReadFile(path)
-		if err != nil {
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
 			continue
 		}
+		found = true
 
-		var name string
-		for line := range strings.SplitSeq(string(data), "\n") {
-			if after, ok := strings.CutPrefix(line, "Name="); ok {
-				name = after
-				name = strings.TrimSpace(name)
-				break
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Skip unreadable subdirectories
+				if d != nil && d.IsDir() && path != dir {
+					return fs.SkipDir
+				}
+				return nil
 			}
-		}
-		if name != "" {
-			apps = append(apps, AppEntry{Name: name, Path: path})
+			if d.IsDir() || !strings.HasSuffix(d.Name(), ".desktop") {
+				return nil
+			}
+
+			id := desktopFileID(dir, path)
+			if seen[id] {
+				return nil
+			}
+			// Shadow lower-precedence files even if this one is invalid
+			seen[id] = true
+
+			df, err := parseDesktopFile(path)
+			if err != nil {
+				return nil
+			}
+			if app, ok := newAppEntry(path, df, locale); ok {
+				app.ID = id
+				apps = append(apps, app)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 
+	if !found {
+		return nil, fmt.Errorf("no applications directory found in %s", strings.Join(dirs, ", "))
+	}
 	return apps, nil
 }
 
+// desktopFileID returns the desktop file ID of path relative to its
+// applications directory, e.g. kde/konsole.desktop becomes kde-konsole.desktop.
+func desktopFileID(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+}
+
 // getMaxItems calculates the number of visible items for the TUI.
 // If cfg.MaxItems >= 0, it returns cfg.MaxItems.
 // If cfg.MaxItems == -1, it auto-detects terminal height.
@@ -6,7 +6,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"syscall"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -19,10 +18,13 @@ type Menu struct {
 	Generator string `toml:"generator,omitempty"`
 	Prompt    string `toml:"prompt,omitempty"`
 	Title     string `toml:"title,omitempty"`
+	Icon      string `toml:"icon,omitempty"`
 	Visible   bool   `toml:"visible,omitempty"`
 	Items     []Menu `toml:"items,omitempty"`
 
 	ID string `toml:"id,omitempty"` // Used for identification for starting submenu
+
+	app *AppEntry // launched instead of Exec (apps category view)
 }
 
 type MenuConfig struct {
@@ -45,11 +47,13 @@ func findMenuByID(menus []Menu, id string) *Menu {
 	return nil
 }
 
-func runMenu(menuConfig *MenuConfig, cfg *Config, args *CLIArgs) {
+func runMenu(menuConfig *MenuConfig, cfg *Config, args *CLIArgs) error {
 	// persistent TUI only for menu mode; caller must ensure correct mode
 	if err := RunPersistentMenuTUI(cfg, args, menuConfig); err != nil {
 		fmt.Fprintln(os.Stderr, "Menu TUI error:", err)
+		return err
 	}
+	return nil
 }
 
 func expandGenerator(cmdStr string) ([]Menu, error) {
@@ -73,21 +77,23 @@ func expandGenerator(cmdStr string) ([]Menu, error) {
 	return result.Items, nil
 }
 
-func executeCommand(cmdStr string, visible bool) error {
-	cmd := exec.Command("/bin/sh", "-c", cmdStr)
+// executeCommand runs a menu exec command through /bin/sh, wrapped in the
+// configured launch_wrapper. Invisible commands are detached.
+func executeCommand(cfg *Config, label, cmdStr string, visible bool) error {
+	argv, err := wrapperArgv(cfg, label, label, []string{"/bin/sh", "-c", cmdStr})
+	if err != nil {
+		return err
+	}
 
 	fmt.Fprintln(os.Stderr, "Executing, state:", visible)
 
 	if !visible {
 		// run detached
-		cmd.Stdout = nil
-		cmd.Stderr = nil
-		cmd.Stdin = nil
-		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
-		return cmd.Start()
+		return startDetached(argv, "", nil, launchLogPath(cfg, label))
 	}
 
 	// visible foreground run
+	cmd := exec.Command(argv[0], argv[1:]...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
@@ -120,7 +126,13 @@ func loadMenu() (*MenuConfig, error) {
 }
 
 func RunPersistentMenuTUI(cfg *Config, args *CLIArgs, menu *MenuConfig) error {
-	m := initialPersistentMenuModel(cfg, args, menu)
+	m := initialPersistentMenuModel(cfg, menu, args.Menu.Timeout.Value, args.Menu.DryRun.Value, "menu")
+	return runPersistentMenu(cfg, m)
+}
+
+// runPersistentMenu runs a persistent menu model, then executes the command
+// or launches the app that was selected.
+func runPersistentMenu(cfg *Config, m model) error {
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	// setup reset channel and start inactivity timer if requested
 	var done chan struct{}
@@ -153,19 +165,33 @@ func RunPersistentMenuTUI(cfg *Config, args *CLIArgs, menu *MenuConfig) error {
 		close(done)
 		timeoutResetCh = nil
 	}
+	if pendingApp != nil {
+		app := *pendingApp
+		pendingApp = nil
+		if m.dryRun {
+			fmt.Println(app.Name)
+			return err
+		}
+		if launchErr := launchDesktopFile(cfg, app, m.files); launchErr != nil {
+			return launchErr
+		}
+		recordSelection(m.history, app.Name)
+	}
 	if pendingExec != "" {
 		// respect dry-run flag for menu mode
-		if args.Menu.DryRun.Value {
+		if m.dryRun {
 			fmt.Fprintln(os.Stdout, "DRY-RUN:", pendingExec)
 			pendingExec = ""
 			return err
 		}
-		execErr := executeCommand(pendingExec, pendingVisible)
+		execErr := executeCommand(cfg, pendingLabel, pendingExec, pendingVisible)
 		pendingExec = ""
 		if execErr != nil {
 			fmt.Fprintln(os.Stderr, "failed to execute command:", execErr)
 			return execErr
 		}
+		// The history is still scoped to the submenu the item was picked from
+		recordSelection(m.history, pendingLabel)
 	}
 	return err
 }
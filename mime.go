@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fileArgs normalizes file arguments for launching: ~ is expanded and
+// relative paths are made absolute. URIs are passed through unchanged.
+func fileArgs(raw []string) []string {
+	files := make([]string, 0, len(raw))
+	for _, f := range raw {
+		if isURI(f) {
+			files = append(files, f)
+			continue
+		}
+		if p, err := resolvePath(f); err == nil {
+			f = p
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// opaqueSchemes are URI schemes commonly written without "//"
+var opaqueSchemes = map[string]bool{
+	"mailto": true, "tel": true, "sms": true, "magnet": true, "geo": true,
+	"xmpp": true, "sip": true, "sips": true, "news": true, "urn": true, "data": true,
+}
+
+// isURI reports whether s looks like a URI with a scheme (e.g. https://,
+// mailto:). Existing files are never URIs, and other names containing a
+// colon, such as "notes:v2.txt", only count with "://" or a scheme from
+// opaqueSchemes.
+func isURI(s string) bool {
+	if _, err := os.Stat(s); err == nil {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil || len(u.Scheme) < 2 || filepath.IsAbs(s) {
+		return false
+	}
+	return strings.Contains(s, "://") || opaqueSchemes[strings.ToLower(u.Scheme)]
+}
+
+// fileMimeType returns the MIME type of a path or URI, or "" if unknown.
+// URIs other than file:// map to x-scheme-handler/<scheme>.
+func fileMimeType(f string) string {
+	if isURI(f) {
+		u, _ := url.Parse(f)
+		if u.Scheme != "file" {
+			return "x-scheme-handler/" + strings.ToLower(u.Scheme)
+		}
+		f = u.Path
+	}
+
+	if info, err := os.Stat(f); err == nil && info.IsDir() {
+		return "inode/directory"
+	}
+	if t := stripMimeParams(mime.TypeByExtension(strings.ToLower(filepath.Ext(f)))); t != "" {
+		return t
+	}
+	return sniffMimeType(f)
+}
+
+// sniffMimeType detects the MIME type of a file from its first bytes, or
+// returns "" if it cannot be read or is unrecognized.
+func sniffMimeType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ""
+	}
+	t := stripMimeParams(http.DetectContentType(buf[:n]))
+	if t == "application/octet-stream" {
+		return ""
+	}
+	return t
+}
+
+// stripMimeParams removes parameters such as "; charset=utf-8"
+func stripMimeParams(t string) string {
+	t, _, _ = strings.Cut(t, ";")
+	return strings.TrimSpace(t)
+}
+
+// appAcceptsMime reports whether app lists mimeType (or a matching wildcard
+// such as image/*) in its MimeType key.
+func appAcceptsMime(app AppEntry, mimeType string) bool {
+	major, _, _ := strings.Cut(mimeType, "/")
+	for _, t := range app.MimeTypes {
+		if strings.EqualFold(t, mimeType) || strings.EqualFold(t, major+"/*") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileMimeTypes returns the MIME types of files, leaving out files of
+// unknown type
+func fileMimeTypes(files []string) []string {
+	var types []string
+	for _, f := range files {
+		if t := fileMimeType(f); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// appAcceptsMimeTypes reports whether app can open files of all mimeTypes
+func appAcceptsMimeTypes(app AppEntry, mimeTypes []string) bool {
+	for _, t := range mimeTypes {
+		if !appAcceptsMime(app, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// appsForFiles returns the apps that can open all files. Files of unknown
+// type do not restrict the choice.
+func appsForFiles(apps []AppEntry, files []string) []AppEntry {
+	types := fileMimeTypes(files)
+	var out []AppEntry
+	for _, app := range apps {
+		if appAcceptsMimeTypes(app, types) {
+			out = append(out, app)
+		}
+	}
+	return out
+}
+
+// mimeAssociations holds the merged contents of the mimeapps.list files
+type mimeAssociations struct {
+	defaults map[string][]string
+	added    map[string][]string
+	removed  map[string][]string
+}
+
+// mimeappsPaths returns the mimeapps.list files in order of precedence
+func mimeappsPaths() []string {
+	var desktops []string
+	for _, d := range currentDesktops() {
+		desktops = append(desktops, strings.ToLower(d))
+	}
+
+	var dirs []string
+	dirs = append(dirs, xdgConfigHome())
+	dirs = append(dirs, xdgConfigDirs()...)
+
+	var paths []string
+	for _, dir := range dirs {
+		for _, d := range desktops {
+			paths = append(paths, filepath.Join(dir, d+"-mimeapps.list"))
+		}
+		paths = append(paths, filepath.Join(dir, "mimeapps.list"))
+	}
+	for _, dir := range applicationDirs() {
+		for _, d := range desktops {
+			paths = append(paths, filepath.Join(dir, d+"-mimeapps.list"))
+		}
+		paths = append(paths, filepath.Join(dir, "mimeapps.list"))
+	}
+	return paths
+}
+
+// loadMimeAssociations reads every mimeapps.list, keeping the order of
+// precedence within each list of desktop file IDs.
+func loadMimeAssociations() *mimeAssociations {
+	assoc := &mimeAssociations{
+		defaults: map[string][]string{},
+		added:    map[string][]string{},
+		removed:  map[string][]string{},
+	}
+	anyKey := func(string) bool { return true }
+
+	for _, path := range mimeappsPaths() {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		kf, err := parseKeyFile(f, anyKey)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		for group, dst := range map[string]map[string][]string{
+			"Default Applications": assoc.defaults,
+			"Added Associations":   assoc.added,
+			"Removed Associations": assoc.removed,
+		} {
+			for mimeType := range kf.group(group) {
+				dst[mimeType] = append(dst[mimeType], kf.group(group).List(mimeType)...)
+			}
+		}
+	}
+	return assoc
+}
+
+// mimeHandlers returns the apps able to open mimeType, the configured default
+// first, followed by added associations and apps listing it in MimeType. The
+// default app's desktop file ID is returned too, or "" if there is none.
+// Other text types fall back to text/plain handlers.
+func mimeHandlers(apps []AppEntry, mimeType string, assoc *mimeAssociations) ([]AppEntry, string) {
+	byID := map[string]AppEntry{}
+	for _, app := range apps {
+		if app.Action == "" {
+			byID[app.ID] = app
+		}
+	}
+
+	types := []string{mimeType}
+	if strings.HasPrefix(mimeType, "text/") && mimeType != "text/plain" {
+		types = append(types, "text/plain")
+	}
+
+	var out []AppEntry
+	seen := map[string]bool{}
+	add := func(app AppEntry, t string) {
+		if seen[app.ID] || slices.Contains(assoc.removed[t], app.ID) {
+			return
+		}
+		seen[app.ID] = true
+		out = append(out, app)
+	}
+
+	defaultID := ""
+	for _, t := range types {
+		for _, id := range assoc.defaults[t] {
+			if app, ok := byID[id]; ok {
+				if defaultID == "" {
+					defaultID = id
+				}
+				add(app, t)
+			}
+		}
+		for _, id := range assoc.added[t] {
+			if app, ok := byID[id]; ok {
+				add(app, t)
+			}
+		}
+		for _, app := range apps {
+			if app.Action == "" && appAcceptsMime(app, t) {
+				add(app, t)
+			}
+		}
+	}
+	return out, defaultID
+}
+
+// setDefaultApp makes the app with desktop file ID id the default for
+// mimeType in $XDG_CONFIG_HOME/mimeapps.list, preserving the rest of the file.
+func setDefaultApp(mimeType, id string) error {
+	path := filepath.Join(xdgConfigHome(), "mimeapps.list")
+
+	var lines []string
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	const group = "[Default Applications]"
+	entry := mimeType + "=" + id + ";"
+
+	groupStart, groupEnd := -1, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == group {
+			groupStart = i
+			continue
+		}
+		if groupStart >= 0 && strings.HasPrefix(trimmed, "[") {
+			groupEnd = i
+			break
+		}
+	}
+
+	switch {
+	case groupStart < 0:
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, group, entry)
+	default:
+		replaced := false
+		for i := groupStart + 1; i < groupEnd; i++ {
+			key, _, ok := strings.Cut(lines[i], "=")
+			if ok && strings.TrimSpace(key) == mimeType {
+				lines[i] = entry
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			// Insert after the last non-blank line of the group
+			at := groupEnd
+			for at > groupStart+1 && strings.TrimSpace(lines[at-1]) == "" {
+				at--
+			}
+			lines = slices.Insert(lines, at, entry)
+		}
+	}
+
+	// Every other app reads this file too, so write a temporary file and
+	// rename it over the original rather than risk leaving it truncated. A
+	// symlinked file (e.g. into a dotfiles repository) is replaced at its
+	// target so the link survives.
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mimeapps-*.list")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
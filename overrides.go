@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// CustomApp is a launcher defined in the config file rather than by a
+// .desktop file
+type CustomApp struct {
+	ID          string   `toml:"id"`
+	Name        string   `toml:"name"`
+	GenericName string   `toml:"generic_name"`
+	Comment     string   `toml:"comment"`
+	Icon        string   `toml:"icon"`
+	Exec        string   `toml:"exec"`
+	Path        string   `toml:"path"`
+	Terminal    bool     `toml:"terminal"`
+	Categories  []string `toml:"categories"`
+	Keywords    []string `toml:"keywords"`
+	MimeTypes   []string `toml:"mime_types"`
+}
+
+// appEntry converts c to an AppEntry. Without an explicit ID one is derived
+// from the name, e.g. "My Tool" becomes "My_Tool.desktop".
+func (c CustomApp) appEntry() AppEntry {
+	id := c.ID
+	if id == "" {
+		id = unitName(c.Name) + ".desktop"
+	}
+	return AppEntry{
+		ID:          id,
+		Name:        c.Name,
+		GenericName: c.GenericName,
+		Comment:     c.Comment,
+		Icon:        c.Icon,
+		Exec:        c.Exec,
+		Binary:      execBinary(c.Exec),
+		WorkDir:     c.Path,
+		Terminal:    c.Terminal,
+		Categories:  c.Categories,
+		Keywords:    c.Keywords,
+		MimeTypes:   c.MimeTypes,
+	}
+}
+
+// applyAppOverrides merges the custom apps from cfg into apps (replacing
+// desktop entries with the same ID), drops apps matching apps.hide and
+// applies apps.rename.
+func applyAppOverrides(cfg *Config, apps []AppEntry) []AppEntry {
+	custom := map[string]AppEntry{}
+	var added []AppEntry
+	for _, c := range cfg.Apps.Custom {
+		if c.Name == "" || c.Exec == "" {
+			fmt.Fprintf(os.Stderr, "Warning: custom app %q needs a name and exec, skipping\n", c.Name)
+			continue
+		}
+		app := c.appEntry()
+		if _, dup := custom[app.ID]; !dup {
+			custom[app.ID] = app
+			added = append(added, app)
+		}
+	}
+
+	hide := compileAppPatterns(cfg.Apps.Hide)
+
+	var result []AppEntry
+	for _, app := range apps {
+		if _, ok := custom[app.ID]; ok {
+			continue
+		}
+		result = append(result, app)
+	}
+	result = append(result, added...)
+
+	apps = result[:0]
+	for _, app := range result {
+		if hide.match(app) {
+			if cfg.Log {
+				fmt.Printf("[DEBUG] Hiding app: %s (%s)\n", app.Name, app.ID)
+			}
+			continue
+		}
+		if name, ok := cfg.Apps.Rename[app.ID]; ok {
+			app.Name = name
+		} else if name, ok := cfg.Apps.Rename[app.Name]; ok {
+			app.Name = name
+		}
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+// appPatterns matches apps by name or desktop file ID
+type appPatterns struct {
+	globs   []string
+	regexps []*regexp.Regexp
+}
+
+// compileAppPatterns parses patterns, each either a glob (e.g. "avahi-*") or
+// a regular expression between slashes (e.g. "/^Avahi/"). Invalid patterns
+// are reported and ignored.
+func compileAppPatterns(patterns []string) appPatterns {
+	var p appPatterns
+	for _, pat := range patterns {
+		if len(pat) >= 2 && strings.HasPrefix(pat, "/") && strings.HasSuffix(pat, "/") {
+			re, err := regexp.Compile(pat[1 : len(pat)-1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: invalid hide pattern %q: %v\n", pat, err)
+				continue
+			}
+			p.regexps = append(p.regexps, re)
+			continue
+		}
+		if _, err := path.Match(pat, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: invalid hide pattern %q: %v\n", pat, err)
+			continue
+		}
+		p.globs = append(p.globs, pat)
+	}
+	return p
+}
+
+// match reports whether the name or desktop file ID of app matches any pattern
+func (p appPatterns) match(app AppEntry) bool {
+	for _, s := range []string{app.Name, app.ID} {
+		if s == "" {
+			continue
+		}
+		for _, g := range p.globs {
+			if ok, _ := path.Match(g, s); ok {
+				return true
+			}
+		}
+		for _, re := range p.regexps {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runIndexVersion must be bumped whenever runIndex changes shape
+const runIndexVersion = 1
+
+// runIndex is the cached list of executables found on $PATH
+type runIndex struct {
+	Version int
+	Dirs    []string
+	Mtimes  map[string]int64
+	Names   []string
+}
+
+// runIndexPath returns the location of the $PATH executable cache
+func runIndexPath() string {
+	return filepath.Join(xdgCacheHome(), "greg", "run.gob")
+}
+
+// pathDirs returns the directories of $PATH in order, without duplicates.
+// Empty entries, which the shell reads as the current directory, are
+// skipped so a launcher never offers whatever happens to be in its working
+// directory.
+func pathDirs() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// pathExecutables returns the sorted, deduplicated names of the executables
+// on $PATH, reusing the cached list while no $PATH directory has changed.
+func pathExecutables(useCache, log bool) []string {
+	dirs := pathDirs()
+	path := runIndexPath()
+
+	if useCache {
+		if idx, err := loadRunIndex(path); err == nil && idx.valid(dirs) {
+			if log {
+				fmt.Printf("[DEBUG] Using cached executable index %s\n", path)
+			}
+			return idx.Names
+		}
+	}
+
+	idx := &runIndex{Version: runIndexVersion, Dirs: dirs, Mtimes: map[string]int64{}}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		idx.Mtimes[dir] = modTime(dir)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if seen[name] || e.IsDir() {
+				continue
+			}
+			if !executableExists(filepath.Join(dir, name)) {
+				continue
+			}
+			seen[name] = true
+			idx.Names = append(idx.Names, name)
+		}
+	}
+	slices.Sort(idx.Names)
+
+	if useCache {
+		if err := saveGob(path, idx); err != nil && log {
+			fmt.Printf("[DEBUG] Failed to write executable index: %v\n", err)
+		}
+	}
+	return idx.Names
+}
+
+// loadRunIndex decodes the executable index at path
+func loadRunIndex(path string) (*runIndex, error) {
+	idx := &runIndex{}
+	if err := loadGob(path, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// valid reports whether the index was built for dirs and none has changed
+func (idx *runIndex) valid(dirs []string) bool {
+	if idx.Version != runIndexVersion || !slices.Equal(idx.Dirs, dirs) {
+		return false
+	}
+	for dir, mtime := range idx.Mtimes {
+		if modTime(dir) != mtime {
+			return false
+		}
+	}
+	return true
+}
+
+// runCommand launches the executable name with the arguments typed after it
+// in input, expanded by the shell. If name is empty, input is run as a shell
+// command instead.
+func runCommand(cfg *Config, name, input string, dryRun bool) error {
+	var argv []string
+	if name == "" {
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return nil
+		}
+		argv = []string{"/bin/sh", "-c", input}
+		name = "run"
+	} else {
+		argv = []string{name}
+		// Arguments go through the shell so ~, $VARS and globs expand
+		if _, rest, ok := strings.Cut(strings.TrimSpace(input), " "); ok && strings.TrimSpace(rest) != "" {
+			argv = []string{"/bin/sh", "-c", formatArgv(argv) + " " + rest}
+		}
+	}
+
+	argv, err := wrapperArgv(cfg, name, name, argv)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Println(formatArgv(argv))
+		return nil
+	}
+	return startDetached(argv, "", launchEnv(cfg, ""), launchLogPath(cfg, name))
+}
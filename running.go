@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// process is a running process of the current user
+type process struct {
+	pid  int
+	argv []string
+}
+
+// runningProcesses scans /proc for processes of the current user, keyed by
+// executable name (both argv[0] and the /proc/<pid>/exe target, so wrapper
+// scripts and renamed processes both match).
+func runningProcesses() map[string][]process {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	uid := uint32(os.Getuid())
+	self := os.Getpid()
+	procs := map[string][]process{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join("/proc", e.Name())
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); !ok || st.Uid != uid {
+			continue
+		}
+
+		// Kernel threads and zombies have an empty command line
+		cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		p := process{pid: pid, argv: strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")}
+
+		names := []string{filepath.Base(p.argv[0])}
+		if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+			names = append(names, filepath.Base(strings.TrimSuffix(exe, " (deleted)")))
+		}
+		for _, name := range slices.Compact(names) {
+			procs[name] = append(procs[name], p)
+		}
+	}
+	return procs
+}
+
+// genericLaunchers are interpreters, shells and wrappers that many unrelated
+// processes run as. Apps started through one of them can't be told apart
+// from the user's other processes, so they are never marked as running.
+var genericLaunchers = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "fish": true, "ksh": true, "csh": true, "tcsh": true,
+	"env": true, "exec": true, "nohup": true, "setsid": true, "sudo": true, "doas": true, "pkexec": true,
+	"flatpak": true, "snap": true, "systemd-run": true, "gtk-launch": true, "xdg-open": true,
+	"dbus-launch": true, "dbus-run-session": true, "wine": true, "mono": true, "dotnet": true,
+	"java": true, "python": true, "pythonw": true, "perl": true, "ruby": true, "node": true, "nodejs": true,
+	"php": true, "lua": true, "gjs": true, "electron": true, "qmlscene": true, "tclsh": true, "wish": true,
+}
+
+// isGenericLauncher reports whether binary is in genericLaunchers, ignoring
+// version suffixes such as python3.12 or lua5.4.
+func isGenericLauncher(binary string) bool {
+	return genericLaunchers[strings.TrimRight(filepath.Base(binary), "0123456789.-")]
+}
+
+// runningApps returns the PIDs of running processes for each app, keyed by
+// app name. A process belongs to an app if it runs the app's program with
+// the fixed arguments of its Exec line. Apps that are not running, or whose
+// program is a generic launcher, are left out.
+func runningApps(apps map[string]AppEntry) map[string][]int {
+	procs := runningProcesses()
+	running := map[string][]int{}
+	for name, app := range apps {
+		cmd := execCommand(app.Exec)
+		if len(cmd) == 0 || isGenericLauncher(cmd[0]) {
+			continue
+		}
+		var pids []int
+		for _, p := range procs[filepath.Base(cmd[0])] {
+			if len(p.argv) >= len(cmd) && slices.Equal(p.argv[1:len(cmd)], cmd[1:]) {
+				pids = append(pids, p.pid)
+			}
+		}
+		if len(pids) > 0 {
+			slices.Sort(pids)
+			running[name] = slices.Compact(pids)
+		}
+	}
+	return running
+}
+
+// runningMsg carries a fresh scan of running apps and a status line
+type runningMsg struct {
+	running map[string][]int
+	status  string
+}
+
+// signalApp sends sig to those of pids that still belong to the app and
+// rescans running apps once they have had a moment to exit. With dryRun the
+// signal is only reported.
+func signalApp(apps map[string]AppEntry, name string, pids []int, sig syscall.Signal, dryRun bool) tea.Cmd {
+	return func() tea.Msg {
+		// PIDs may have been reused since the list was drawn
+		current := runningApps(apps)[name]
+		pids = slices.DeleteFunc(slices.Clone(pids), func(pid int) bool { return !slices.Contains(current, pid) })
+		if len(pids) == 0 {
+			return runningMsg{runningApps(apps), name + " is no longer running"}
+		}
+
+		if dryRun {
+			return runningMsg{runningApps(apps), fmt.Sprintf("dry run: would send %s to %s (%s)", sigName(sig), name, joinPIDs(pids))}
+		}
+
+		var failed []string
+		for _, pid := range pids {
+			if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+				failed = append(failed, fmt.Sprintf("%d: %v", pid, err))
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+
+		status := fmt.Sprintf("sent %s to %s", sigName(sig), name)
+		if len(failed) > 0 {
+			status += " (failed: " + strings.Join(failed, ", ") + ")"
+		}
+		return runningMsg{runningApps(apps), status}
+	}
+}
+
+// focusApp runs cfg.Apps.FocusCommand for each of pids in turn until one
+// succeeds. The compositor-specific command receives the PID as {pid}.
+func focusApp(cfg *Config, pids []int) error {
+	var lastErr error
+	for _, pid := range pids {
+		cmdStr := strings.ReplaceAll(cfg.Apps.FocusCommand, "{pid}", strconv.Itoa(pid))
+		if cfg.Log {
+			fmt.Printf("[DEBUG] Focusing: %s\n", cmdStr)
+		}
+		if lastErr = exec.Command("/bin/sh", "-c", cmdStr).Run(); lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to focus window: %w", lastErr)
+}
+
+func sigName(sig syscall.Signal) string {
+	switch sig {
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	case syscall.SIGKILL:
+		return "SIGKILL"
+	}
+	return sig.String()
+}
+
+func joinPIDs(pids []int) string {
+	s := make([]string, len(pids))
+	for i, pid := range pids {
+		s[i] = strconv.Itoa(pid)
+	}
+	return strings.Join(s, ", ")
+}
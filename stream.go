@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// streamInterval is how often items read from stdin are handed to the TUI
+const streamInterval = 50 * time.Millisecond
+
+// itemsMsg delivers a batch of items read from stdin
+type itemsMsg []string
+
+// itemsDoneMsg signals the end of input, with the read error if any
+type itemsDoneMsg struct {
+	err error
+}
+
+// streamItems reads items from r (lines, or NUL-separated with read0) and
+// sends them to p in batches until EOF, followed by an itemsDoneMsg. Lines
+// may be of any length; a trailing CR from CRLF line endings is dropped.
+// Items are otherwise passed on byte for byte, so the selection printed is
+// exactly what was read.
+func streamItems(p *tea.Program, r io.Reader, read0 bool) {
+	var mu sync.Mutex
+	var batch []string
+	done := make(chan error, 1)
+
+	go func() {
+		delim := byte('\n')
+		if read0 {
+			delim = 0
+		}
+		reader := bufio.NewReaderSize(r, 64*1024)
+		for {
+			line, err := reader.ReadBytes(delim)
+			if len(line) > 0 {
+				line = bytes.TrimSuffix(line, []byte{delim})
+				if !read0 {
+					line = bytes.TrimSuffix(line, []byte("\r"))
+				}
+				mu.Lock()
+				batch = append(batch, string(line))
+				mu.Unlock()
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				done <- err
+				return
+			}
+		}
+	}()
+
+	flush := func() {
+		mu.Lock()
+		items := batch
+		batch = nil
+		mu.Unlock()
+		if len(items) > 0 {
+			p.Send(itemsMsg(items))
+		}
+	}
+
+	ticker := time.NewTicker(streamInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			flush()
+		case err := <-done:
+			flush()
+			p.Send(itemsDoneMsg{err})
+			return
+		}
+	}
+}
@@ -2,10 +2,17 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -13,6 +20,8 @@ import (
 
 var pendingExec string
 var pendingVisible bool
+var pendingLabel string
+var pendingApp *AppEntry
 
 // timeoutMsg signals the TUI to exit due to inactivity
 type timeoutMsg struct{}
@@ -27,7 +36,9 @@ type model struct {
 	dryRun bool
 	// generic TUI fields
 	allItems         []string
-	filtered         []string
+	ranked           []int // positions of all items in display order
+	filtered         []int // positions of the items matching the query
+	scores           []int // match scores of filtered, nil when not filtering
 	cursor           int
 	input            string
 	width            int
@@ -43,9 +54,50 @@ type model struct {
 	mainHeader string
 	helpText   string
 
+	// selection history used for frecency ranking (nil disables)
+	history *History
+
+	// apps mode: secondary text matched below the item name, comments
+	// optionally rendered next to items, the app behind each label and files
+	// given on the command line
+	searchExtra map[string]string
+	comments    map[string]string
+	appsByLabel map[string]AppEntry
+	files       []string
+
+	// icons rendered next to items (nil when the terminal has no graphics
+	// support), keyed by item
+	icons     *iconRenderer
+	itemIcons map[string]string
+
+	// apps mode: PIDs of running apps keyed by item, whether enter should
+	// focus the running instance, the item awaiting a second ctrl+x to be
+	// killed, and a status line for signal results
+	running     map[string][]int
+	focus       bool
+	confirmKill string
+	status      string
+
+	// dmenu --multi: positions of marked items
+	multi  bool
+	marked map[int]bool
+
+	// dmenu --print0: terminate printed items with NUL
+	print0 bool
+	// dmenu --index: print input positions instead of items
+	index bool
+
+	// dmenu: items still being read from stdin (NUL-separated with read0),
+	// and the error that ended reading, if any
+	stdin   io.Reader
+	read0   bool
+	loading bool
+	readErr error
+
 	// persistent menu mode fields
 	isMenuMode bool
 	menuStack  [][]Menu
+	menuPath   []string
 	current    []Menu
 	labels     []string
 }
@@ -68,6 +120,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			default:
 			}
 		}
+		m.status = ""
+		confirmKill := m.confirmKill
+		m.confirmKill = ""
 
 		// ESC
 		if key == "esc" {
@@ -75,6 +130,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// go up one menu level
 				m.current = m.menuStack[len(m.menuStack)-1]
 				m.menuStack = m.menuStack[:len(m.menuStack)-1]
+				m.menuPath = m.menuPath[:len(m.menuPath)-1]
 				m.updateMenuLabels()
 				// restore cursor/windowStart if available
 				if len(m.cursorStack) > 0 {
@@ -120,7 +176,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if len(m.filtered) == 0 {
 					return m, nil
 				}
-				selected := m.filtered[m.cursor]
+				selected := m.selectedItem()
 
 				for _, item := range m.current {
 
@@ -134,6 +190,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.cursorStack = append(m.cursorStack, m.cursor)
 						m.windowStartStack = append(m.windowStartStack, m.windowStart)
 						m.menuStack = append(m.menuStack, m.current)
+						m.menuPath = append(m.menuPath, item.Label)
 						m.current = item.Items
 						m.updateMenuLabels()
 						m.cursor = 0
@@ -149,6 +206,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							m.cursorStack = append(m.cursorStack, m.cursor)
 							m.windowStartStack = append(m.windowStartStack, m.windowStart)
 							m.menuStack = append(m.menuStack, m.current)
+							m.menuPath = append(m.menuPath, item.Label)
 							m.current = gen
 							m.updateMenuLabels()
 							m.cursor = 0
@@ -157,36 +215,90 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						return m, nil
 					}
 
+					// APP
+					if item.app != nil {
+						pendingApp = item.app
+						return m, tea.Quit
+					}
+
 					// EXEC
 					if item.Exec != "" {
 						pendingExec = item.Exec
 						pendingVisible = item.Visible
+						pendingLabel = item.Label
 						return m, tea.Quit
 					}
 				}
 				return m, nil
 			}
 
+			// focus the running instance if possible, unless there are
+			// files to open
+			if m.mode == "apps" && m.config.Apps.FocusCommand != "" && len(m.filtered) > 0 &&
+				len(m.files) == 0 && len(m.typedFiles()) == 0 {
+				m.focus = len(m.running[m.selectedItem()]) > 0
+			}
+
 			// normal (dmenu/apps) mode
 			return m, tea.Quit
 		}
 
-		// Navigation
-		switch key {
-		case "up", "k":
-			if m.cursor > 0 {
-				m.cursor--
-				if m.cursor < m.windowStart {
-					m.windowStart--
+		// Multi-select marks
+		if m.multi {
+			switch key {
+			case "tab", "shift+tab":
+				if len(m.filtered) == 0 {
+					return m, nil
+				}
+				pos := m.filtered[m.cursor]
+				if key == "tab" {
+					m.setMarked(pos, !m.marked[pos])
+					m.moveCursor(1)
+				} else {
+					m.setMarked(pos, false)
+					m.moveCursor(-1)
+				}
+				return m, nil
+			case "ctrl+a":
+				for _, pos := range m.filtered {
+					m.setMarked(pos, true)
 				}
+				return m, nil
 			}
-		case "down", "j":
-			if m.cursor < len(m.filtered)-1 {
-				m.cursor++
-				if m.cursor >= m.windowStart+m.config.MaxItems {
-					m.windowStart++
+		}
+
+		// Running app actions
+		if m.mode == "apps" && len(m.filtered) > 0 {
+			item := m.selectedItem()
+			switch key {
+			case "ctrl+n":
+				// always start a new instance
+				return m, tea.Quit
+			case "ctrl+t", "ctrl+x":
+				pids := m.running[item]
+				if len(pids) == 0 {
+					m.status = item + " is not running"
+					return m, nil
 				}
+				sig := syscall.SIGTERM
+				if key == "ctrl+x" {
+					if confirmKill != item {
+						m.confirmKill = item
+						m.status = fmt.Sprintf("press ctrl+x again to SIGKILL %s (%s)", item, joinPIDs(pids))
+						return m, nil
+					}
+					sig = syscall.SIGKILL
+				}
+				return m, signalApp(m.appsByLabel, item, pids, sig, m.dryRun)
 			}
+		}
+
+		// Navigation
+		switch key {
+		case "up", "k":
+			m.moveCursor(-1)
+		case "down", "j":
+			m.moveCursor(1)
 
 		case "backspace":
 			if len(m.input) > 0 {
@@ -203,6 +315,26 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case itemsMsg:
+		from := len(m.allItems)
+		m.allItems = append(m.allItems, ev...)
+		m.ranked = m.history.Merge(m.ranked, m.allItems, from)
+		if m.scores == nil {
+			m.filtered = m.ranked
+		} else {
+			// Only score the new items, then merge them into the matches
+			batch := m.history.Merge(nil, m.allItems, from)
+			m.mergeMatches(m.matchPositions(batch, strings.ToLower(m.query()), nil))
+		}
+
+	case itemsDoneMsg:
+		m.loading = false
+		m.readErr = ev.err
+
+	case runningMsg:
+		m.running = ev.running
+		m.status = ev.status
+
 	case tea.WindowSizeMsg:
 		m.width = ev.Width
 		m.height = ev.Height
@@ -216,35 +348,295 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-func (m *model) filterItems() {
-	var src []string
+// moveCursor moves the cursor by one item up (-1) or down (1), scrolling
+// the window to keep it visible.
+func (m *model) moveCursor(delta int) {
+	switch {
+	case delta < 0 && m.cursor > 0:
+		m.cursor--
+		if m.cursor < m.windowStart {
+			m.windowStart--
+		}
+	case delta > 0 && m.cursor < len(m.filtered)-1:
+		m.cursor++
+		if m.cursor >= m.windowStart+m.config.MaxItems {
+			m.windowStart++
+		}
+	}
+}
+
+// source returns the items that positions in ranked and filtered refer to
+func (m model) source() []string {
 	if m.isMenuMode {
-		src = m.labels
+		return m.labels
+	}
+	return m.allItems
+}
+
+// selectedItem returns the item under the cursor; filtered must not be empty
+func (m model) selectedItem() string {
+	return m.source()[m.filtered[m.cursor]]
+}
+
+// setMarked marks or unmarks the item at pos in multi-select mode
+func (m *model) setMarked(pos int, marked bool) {
+	if m.marked == nil {
+		m.marked = map[int]bool{}
+	}
+	if marked {
+		m.marked[pos] = true
 	} else {
-		src = m.allItems
+		delete(m.marked, pos)
 	}
+}
+
+// markedPositions returns the positions of the marked items in input
+// order, or that of the item under the cursor when nothing is marked.
+func (m model) markedPositions() []int {
+	if len(m.marked) == 0 {
+		return []int{m.filtered[m.cursor]}
+	}
+	positions := make([]int, 0, len(m.marked))
+	for pos := range m.marked {
+		positions = append(positions, pos)
+	}
+	slices.Sort(positions)
+	return positions
+}
 
-	if m.input == "" {
-		m.filtered = src
+// markedItems returns the marked items in input order, or the item under
+// the cursor when nothing is marked.
+func (m model) markedItems() []string {
+	src := m.source()
+	var items []string
+	for _, pos := range m.markedPositions() {
+		items = append(items, src[pos])
+	}
+	return items
+}
+
+func (m *model) filterItems() {
+	query := strings.ToLower(m.query())
+	files := m.typedFiles()
+	if query == "" && len(files) == 0 {
+		m.filtered = m.ranked
+		m.scores = nil
 		m.cursor = 0
 		m.windowStart = 0
 		return
 	}
 
-	var f []string
-	for _, item := range src {
-		if strings.Contains(strings.ToLower(item), strings.ToLower(m.input)) {
-			f = append(f, item)
+	// Detect the types once rather than for every app
+	m.filtered, m.scores = m.matchPositions(m.ranked, query, fileMimeTypes(files))
+	if m.cursor >= len(m.filtered) {
+		m.cursor = 0
+	}
+	if m.windowStart >= len(m.filtered) {
+		m.windowStart = 0
+	}
+}
+
+// matchPositions returns those of positions whose items match query (and,
+// for apps, can open files of fileTypes) with their scores, ordered by
+// descending score and otherwise keeping the order of positions.
+func (m *model) matchPositions(positions []int, query string, fileTypes []string) ([]int, []int) {
+	src := m.source()
+
+	type match struct {
+		pos   int
+		score int
+	}
+	var matches []match
+	for _, pos := range positions {
+		item := src[pos]
+		// Only offer apps that can open the typed files
+		if app, ok := m.appsByLabel[item]; ok && len(fileTypes) > 0 && !appAcceptsMimeTypes(app, fileTypes) {
+			continue
+		}
+		score := 1
+		if query != "" {
+			score = matchScore(item, m.searchExtra[item], query, m.mode == "apps")
+		}
+		if score > 0 {
+			matches = append(matches, match{pos, score})
 		}
 	}
 
-	m.filtered = f
-	if m.cursor >= len(f) {
-		m.cursor = 0
+	// Name matches rank above matches on secondary text
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+	filtered := make([]int, len(matches))
+	scores := make([]int, len(matches))
+	for i, mt := range matches {
+		filtered[i], scores[i] = mt.pos, mt.score
 	}
-	if m.windowStart >= len(f) {
-		m.windowStart = 0
+	return filtered, scores
+}
+
+// mergeMatches merges the matches of newly read items (positions, scores)
+// into the current ones, both ordered by descending score. Equal scores are
+// ordered by frecency and then by input position, as filterItems would.
+func (m *model) mergeMatches(positions, scores []int) {
+	if len(positions) == 0 {
+		return
+	}
+	src := m.source()
+	now := time.Now()
+	frecency := func(pos int) float64 {
+		if m.history == nil {
+			return 0
+		}
+		return m.history.score(src[pos], now)
 	}
+
+	old, oldScores := m.filtered, m.scores
+	m.filtered = make([]int, 0, len(old)+len(positions))
+	m.scores = make([]int, 0, len(old)+len(positions))
+	i, j := 0, 0
+	for i < len(old) || j < len(positions) {
+		takeOld := j == len(positions)
+		if i < len(old) && j < len(positions) {
+			takeOld = oldScores[i] > scores[j] ||
+				oldScores[i] == scores[j] && frecency(old[i]) >= frecency(positions[j])
+		}
+		if takeOld {
+			m.filtered, m.scores = append(m.filtered, old[i]), append(m.scores, oldScores[i])
+			i++
+		} else {
+			m.filtered, m.scores = append(m.filtered, positions[j]), append(m.scores, scores[j])
+			j++
+		}
+	}
+}
+
+// query returns the text items are filtered by. In run mode only the first
+// word is used; the rest are arguments for the command. In apps mode text
+// after "--" lists files to open rather than being part of the query.
+func (m model) query() string {
+	switch m.mode {
+	case "run":
+		name, _, _ := strings.Cut(strings.TrimLeft(m.input, " "), " ")
+		return name
+	case "apps":
+		name, _, _ := strings.Cut(" "+m.input+" ", " -- ")
+		return strings.TrimSpace(name)
+	}
+	return m.input
+}
+
+// typedFiles returns the files typed after "--" in apps mode
+func (m model) typedFiles() []string {
+	if m.mode != "apps" {
+		return nil
+	}
+	_, rest, ok := strings.Cut(" "+m.input+" ", " -- ")
+	if !ok {
+		return nil
+	}
+	tokens, err := tokenizeExec(rest)
+	if err != nil {
+		return nil
+	}
+	raw := make([]string, len(tokens))
+	for i, t := range tokens {
+		raw[i] = t.text
+	}
+	return fileArgs(raw)
+}
+
+// displayLimit caps the number of characters drawn for a single item;
+// anything longer would be cut off by the terminal anyway.
+const displayLimit = 512
+
+// displayText makes item safe to draw in the terminal: control characters
+// are shown in caret notation (e.g. ^[ for ESC), invalid UTF-8 bytes as
+// U+FFFD and overlong items are cut short. Tabs are kept and expanded by
+// lipgloss.
+func displayText(item string) string {
+	clean := len(item) <= displayLimit
+	for _, r := range item {
+		if !clean {
+			break
+		}
+		clean = r != utf8.RuneError && (r == '\t' || !unicode.IsControl(r))
+	}
+	if clean {
+		return item
+	}
+
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(item); n++ {
+		if n == displayLimit {
+			b.WriteRune('…')
+			break
+		}
+		r, size := utf8.DecodeRuneInString(item[i:])
+		i += size
+		switch {
+		case r == '\t':
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte('^')
+			b.WriteByte(byte(r) + '@')
+		case r == 0x7f:
+			b.WriteString("^?")
+		case unicode.IsControl(r):
+			// C1 controls
+			b.WriteRune(utf8.RuneError)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// matchScore ranks how well item (or its secondary text) matches query, 0
+// meaning no match. In apps mode a name prefix scores 3, a name substring 2
+// and a secondary match 1; other modes score every match 1 so that results
+// keep their input order.
+func matchScore(item, extra, query string, apps bool) int {
+	name := strings.ToLower(item)
+	switch {
+	case !apps:
+		if strings.Contains(name, query) {
+			return 1
+		}
+	case strings.HasPrefix(name, query):
+		return 3
+	case strings.Contains(name, query):
+		return 2
+	case extra != "" && strings.Contains(strings.ToLower(extra), query):
+		return 1
+	}
+	return 0
+}
+
+// setApps records the secondary search text (and comments, if shown) of
+// apps, keyed by the labels from appLabels.
+func (m *model) setApps(apps []AppEntry, showComments bool) {
+	m.searchExtra = make(map[string]string, len(apps))
+	m.appsByLabel = make(map[string]AppEntry, len(apps))
+	m.itemIcons = make(map[string]string, len(apps))
+	if showComments {
+		m.comments = make(map[string]string, len(apps))
+	}
+	for i, label := range appLabels(apps) {
+		app := apps[i]
+		m.searchExtra[label] = app.searchText()
+		m.appsByLabel[label] = app
+		m.itemIcons[label] = app.Icon
+		if showComments && app.Comment != "" {
+			m.comments[label] = app.Comment
+		}
+	}
+}
+
+// setComment sets the secondary text rendered next to item
+func (m *model) setComment(item, comment string) {
+	if m.comments == nil {
+		m.comments = map[string]string{}
+	}
+	m.comments[item] = comment
 }
 
 func (m model) View() string {
@@ -271,23 +663,61 @@ func (m model) View() string {
 	visible := m.filtered[start:end]
 
 	var list strings.Builder
-	for i, item := range visible {
+	src := m.source()
+	showIcons := m.icons != nil && len(m.itemIcons) > 0
+	for i, pos := range visible {
+		item := src[pos]
+		if showIcons {
+			list.WriteString(m.icons.render(m.itemIcons[item]))
+		}
+		label := displayText(item)
+		if m.multi {
+			if m.marked[pos] {
+				label = "✓ " + label
+			} else {
+				label = "  " + label
+			}
+		}
 		if start+i == m.cursor {
-			list.WriteString(selectedStyle.Render(" > "+item) + "\n")
+			list.WriteString(selectedStyle.Render(" > " + label))
 		} else {
-			list.WriteString(itemStyle.Render("   "+item) + "\n")
+			list.WriteString(itemStyle.Render("   " + label))
+		}
+		if len(m.running[item]) > 0 {
+			list.WriteString(promptStyle.Render(" ●"))
 		}
+		if comment := m.comments[item]; comment != "" {
+			list.WriteString(helpStyle.Render("  " + comment))
+		}
+		list.WriteString("\n")
 	}
 
-	if len(m.filtered) == 0 {
+	if len(m.filtered) == 0 && !(m.loading && len(m.allItems) == 0) {
 		list.WriteString(helpStyle.Render("   no matches found"))
 	}
 
+	status := m.status
+	if status == "" && m.readErr != nil {
+		status = "failed to read input: " + m.readErr.Error()
+	}
+	if status == "" && m.loading {
+		status = fmt.Sprintf("reading input… %d items", len(m.allItems))
+	}
+	if status == "" && m.multi {
+		status = fmt.Sprintf("%d marked - tab mark, shift+tab unmark, ctrl+a mark all", len(m.marked))
+	}
+	if status == "" && m.cursor >= 0 && m.cursor < len(m.filtered) && len(m.running[m.selectedItem()]) > 0 {
+		status = "● running - ctrl+n new instance, ctrl+t terminate, ctrl+x kill"
+	}
+	if status != "" {
+		list.WriteString("\n" + helpStyle.Render("   "+status))
+	}
+
 	content := lipgloss.JoinVertical(lipgloss.Left, header, prompt, list.String())
 	return lipgloss.NewStyle().Margin(1, 2).Render(content)
 }
 
-func RunTUIWithItems(cfg *Config, mode model, items []string, apps []AppEntry) (string, error) {
+func RunTUIWithItems(cfg *Config, mode model, items []string) (string, error) {
 	p := tea.NewProgram(mode, tea.WithAltScreen())
 	// setup reset channel and start inactivity timer if requested
 	var done chan struct{}
@@ -315,6 +745,9 @@ func RunTUIWithItems(cfg *Config, mode model, items []string, apps []AppEntry) (
 			}
 		}()
 	}
+	if mode.stdin != nil {
+		go streamItems(p, mode.stdin, mode.read0)
+	}
 	m, err := p.Run()
 	// stop timer goroutine
 	if mode.timeout > 0 {
@@ -326,35 +759,91 @@ func RunTUIWithItems(cfg *Config, mode model, items []string, apps []AppEntry) (
 	}
 
 	mod := m.(model)
+	if mod.readErr != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to read input -", mod.readErr)
+	}
 
-	if len(mod.filtered) == 0 || mod.cursor == -1 {
+	// run mode falls back to the typed text when nothing matches
+	if mod.mode == "run" && len(mod.filtered) == 0 && mod.cursor != -1 {
+		return "", runCommand(cfg, "", mod.input, mod.dryRun)
+	}
+
+	// Marked items are printed even when the filter hides all of them
+	marked := mod.multi && len(mod.marked) > 0
+	if mod.cursor == -1 || len(mod.filtered) == 0 && !marked {
 		return "", nil
 	}
 
-	selected := mod.filtered[mod.cursor]
+	var selected string
+	if len(mod.filtered) > 0 {
+		selected = mod.selectedItem()
+	}
 
 	switch mod.mode {
 	case "dmenu":
+		chosen := []string{selected}
+		if mod.multi {
+			chosen = mod.markedItems()
+		}
+		lines := chosen
+		if mod.index {
+			var positions []int
+			if mod.multi {
+				positions = mod.markedPositions()
+			} else {
+				positions = []int{mod.filtered[mod.cursor]}
+			}
+			lines = make([]string, len(positions))
+			for i, pos := range positions {
+				lines[i] = strconv.Itoa(pos)
+			}
+		}
+		term := "\n"
+		if mod.print0 {
+			term = "\x00"
+		}
+		output := strings.Join(lines, term) + term
 		if mod.out != "" {
 			if err := os.MkdirAll(filepath.Dir(mod.out), 0755); err != nil {
 				return "", fmt.Errorf("failed to create output directory: %w", err)
 			}
-			if err := os.WriteFile(mod.out, []byte(selected+"\n"), 0644); err != nil {
+			if err := os.WriteFile(mod.out, []byte(output), 0644); err != nil {
 				return "", fmt.Errorf("failed to write selection: %w", err)
 			}
 		} else {
-			fmt.Println(selected)
+			fmt.Print(output)
+		}
+		if !mod.dryRun {
+			recordSelection(mod.history, chosen...)
 		}
 
-	case "apps":
-		for _, app := range apps {
-			if app.Name == selected {
-				if mod.dryRun {
-					fmt.Println(selected)
-					return "", nil
+	case "apps", "open":
+		if app, ok := mod.appsByLabel[selected]; ok {
+			if mod.dryRun {
+				fmt.Println(selected)
+				return selected, nil
+			}
+			if mod.focus {
+				if err := focusApp(cfg, mod.running[selected]); err != nil {
+					return "", err
 				}
-				return "", launchDesktopFile(app.Path)
+				recordSelection(mod.history, selected)
+				return selected, nil
 			}
+			files := append(slices.Clone(mod.files), mod.typedFiles()...)
+			if err := launchDesktopFile(cfg, app, files); err != nil {
+				return "", err
+			}
+			recordSelection(mod.history, selected)
+			return selected, nil
+		}
+
+	case "run":
+		if err := runCommand(cfg, selected, mod.input, mod.dryRun); err != nil {
+			return "", err
+		}
+		if !mod.dryRun {
+			recordSelection(mod.history, selected)
 		}
 
 	case "menu":
@@ -378,9 +867,16 @@ func initialModelWithItems(cfg *Config, mode string, prompt string, out string,
 		helpText = " - type to filter, ↑↓ to move, enter to select, esc to go back"
 	}
 
+	var icons *iconRenderer
+	if mode == "apps" || mode == "open" {
+		icons = newIconRenderer(cfg)
+	}
+
+	ranked := positions(len(items))
 	return model{
 		allItems:    items,
-		filtered:    items,
+		ranked:      ranked,
+		filtered:    ranked,
 		config:      cfg,
 		mode:        mode,
 		prompt:      prompt,
@@ -388,10 +884,11 @@ func initialModelWithItems(cfg *Config, mode string, prompt string, out string,
 		mainHeader:  header,
 		helpText:    helpText,
 		windowStart: 0,
+		icons:       icons,
 	}
 }
 
-func initialPersistentMenuModel(cfg *Config, args *CLIArgs, menu *MenuConfig) model {
+func initialPersistentMenuModel(cfg *Config, menu *MenuConfig, timeout int, dryRun bool, historyKey string) model {
 	// default timeout is 0 (disabled)
 	prompt := menu.Prompt
 	if prompt == "" {
@@ -413,9 +910,10 @@ func initialPersistentMenuModel(cfg *Config, args *CLIArgs, menu *MenuConfig) mo
 		isMenuMode: true,
 		current:    menu.Menu,
 		menuStack:  [][]Menu{},
-		// set timeout and dry-run from CLI args if present
-		timeout: args.Menu.Timeout.Value,
-		dryRun:  args.Menu.DryRun.Value,
+		timeout:    timeout,
+		dryRun:     dryRun,
+		history:    openHistory(historyKey),
+		icons:      newIconRenderer(cfg),
 	}
 
 	m.updateMenuLabels()
@@ -425,8 +923,34 @@ func initialPersistentMenuModel(cfg *Config, args *CLIArgs, menu *MenuConfig) mo
 func (m *model) updateMenuLabels() {
 	m.input = ""
 	m.labels = m.labels[:0]
+	m.itemIcons = map[string]string{}
 	for _, item := range m.current {
 		m.labels = append(m.labels, item.Label)
+		switch {
+		case item.Icon != "":
+			m.itemIcons[item.Label] = item.Icon
+		case item.app != nil && item.app.Icon != "":
+			m.itemIcons[item.Label] = item.app.Icon
+		}
+	}
+	// Equal labels in different submenus are ranked separately. Apps in the
+	// category view keep their plain names, shared with the flat apps view.
+	scope := ""
+	if len(m.menuPath) > 0 && !slices.ContainsFunc(m.current, func(item Menu) bool { return item.app != nil }) {
+		scope = strings.Join(m.menuPath, " › ") + " › "
+	}
+	m.history.SetScope(scope)
+	m.history.Sort(m.labels)
+	m.ranked = positions(len(m.labels))
+	m.filtered = m.ranked
+	m.scores = nil
+}
+
+// positions returns the positions 0 to n-1 of a list of n items
+func positions(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
 	}
-	m.filtered = m.labels
+	return p
 }
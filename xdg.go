@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// xdgDir returns the directory named by env, falling back to fallback
+// (relative to the home directory) when unset or not absolute.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, fallback)
+}
+
+// xdgDataHome returns $XDG_DATA_HOME, defaulting to ~/.local/share
+func xdgDataHome() string {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// xdgDataDirs returns $XDG_DATA_DIRS, defaulting to /usr/local/share:/usr/share
+func xdgDataDirs() []string {
+	env := os.Getenv("XDG_DATA_DIRS")
+	if env == "" {
+		env = "/usr/local/share:/usr/share"
+	}
+
+	var dirs []string
+	for _, dir := range filepath.SplitList(env) {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// applicationDirs returns the applications directories to search for desktop
+// entries, in order of precedence (user entries first).
+func applicationDirs() []string {
+	var dirs []string
+	if home := xdgDataHome(); home != "" {
+		dirs = append(dirs, filepath.Join(home, "applications"))
+	}
+	for _, dir := range xdgDataDirs() {
+		dirs = append(dirs, filepath.Join(dir, "applications"))
+	}
+	return dirs
+}
+
+// xdgStateHome returns $XDG_STATE_HOME, defaulting to ~/.local/state
+func xdgStateHome() string {
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// xdgCacheHome returns $XDG_CACHE_HOME, defaulting to ~/.cache
+func xdgCacheHome() string {
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// xdgConfigHome returns $XDG_CONFIG_HOME, defaulting to ~/.config
+func xdgConfigHome() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// xdgConfigDirs returns $XDG_CONFIG_DIRS, defaulting to /etc/xdg
+func xdgConfigDirs() []string {
+	env := os.Getenv("XDG_CONFIG_DIRS")
+	if env == "" {
+		env = "/etc/xdg"
+	}
+
+	var dirs []string
+	for _, dir := range filepath.SplitList(env) {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}